@@ -0,0 +1,139 @@
+package iec62056
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// ErrInsufficientAccess is matched by errors of commands refused by device for the current access level.
+// IEC 62056-21 does not standardise error messages, so detection of refusals is opt-in:
+// list the error message values of the device in Quirks.AccessDenied, e.g.
+//
+//	RegisterQuirks("ABC", Quirks{AccessDenied: []string{"ERR04"}})
+//
+// Without the list error messages are returned as data blocks by Command.
+var ErrInsufficientAccess = errors.New("insufficient access level")
+
+// AccessError is returned when device refuses a write or execute command for authorisation reasons.
+// It matches ErrInsufficientAccess with errors.Is.
+type AccessError struct {
+	// Refused command.
+	Command CommandId
+	// Access level at the time of the command.
+	Level int
+	// Error message sent by device, empty if the command was not sent.
+	Reply string
+}
+
+func (e *AccessError) Error() string {
+	rv := "command " + e.Command.String() + " refused at access level " + strconv.Itoa(e.Level)
+	if e.Reply != "" {
+		rv += ": " + e.Reply
+	}
+	return rv
+}
+
+func (e *AccessError) Unwrap() error {
+	return ErrInsufficientAccess
+}
+
+// Elevate raises access level of the programming mode session to at least level.
+// It enters programming mode if needed and sends the password supplied by PasswordProvider for the level.
+// It returns *AccessError if the accepted password has a lower level.
+func (t *TariffDevice) Elevate(level int) error {
+	return t.ElevateContext(context.Background(), level)
+}
+
+// ElevateContext raises access level like Elevate. ctx is passed to PasswordProvider.
+func (t *TariffDevice) ElevateContext(ctx context.Context, level int) error {
+	if !t.isInProgrammingMode() {
+		signOn := t.SignOnLevel
+		if signOn < level {
+			signOn = level
+		}
+		if err := t.enterProgrammingMode(ctx, signOn); err != nil {
+			return err
+		}
+	} else if t.accessLevel < level {
+		provider := t.passwordProvider()
+		if provider == nil {
+			return &AccessError{Command: CmdP1, Level: t.accessLevel}
+		}
+		if err := t.authenticate(ctx, provider, level); err != nil {
+			return err
+		}
+	}
+	if t.accessLevel < level {
+		return &AccessError{Command: CmdP1, Level: t.accessLevel}
+	}
+	return nil
+}
+
+// authenticate sends password of provider for level using operand of the session.
+func (t *TariffDevice) authenticate(ctx context.Context, provider PasswordProvider, level int) error {
+	pw, err := t.password(ctx, provider, level)
+	if err != nil {
+		return err
+	}
+
+	passCmd := &Command{
+		Id:      pw.Command,
+		Payload: &pw.Value,
+	}
+
+	data, err := passCmd.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = t.cmd(data)
+	if err != nil {
+		if err == ErrNAK {
+			return ErrInvalidPassword
+		}
+		return err
+	}
+
+	if data[0] == 'B' && data[1] == '0' {
+		return errors.New("device sent break")
+	}
+	if data[0] != ack {
+		var r DataSet
+		if err = r.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		if q := t.quirks().PasswordReply; q == "" || r.Value != q {
+			if r.Value != "" {
+				return errors.New(r.Value)
+			}
+			return ErrInvalidPassword
+		}
+	}
+	t.programmingMode = true
+	// password of unknown level grants the requested one, at least 1
+	t.accessLevel = pw.Level
+	if t.accessLevel == 0 {
+		t.accessLevel = level
+	}
+	if t.accessLevel == 0 {
+		t.accessLevel = 1
+	}
+	return nil
+}
+
+// accessDenied reports whether reply data of command id is an error message meaning insufficient access level.
+func (t *TariffDevice) accessDenied(id CommandId, data []byte) (string, bool) {
+	if !isWriteCommand(id) {
+		return "", false
+	}
+	var r DataSet
+	if err := r.UnmarshalBinary(data); err != nil {
+		return "", false
+	}
+	for _, v := range t.quirks().AccessDenied {
+		if r.Value == v {
+			return r.Value, true
+		}
+	}
+	return "", false
+}
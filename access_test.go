@@ -0,0 +1,203 @@
+package iec62056
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTariffDevice_Elevate(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     int
+		provider  *testProvider
+		reply     []byte
+		wantTx    string
+		wantLevel int
+		wantErr   error
+	}{
+		{
+			name:      "Already granted",
+			level:     1,
+			provider:  &testProvider{},
+			wantLevel: 1,
+		},
+		{
+			name:      "Level of password",
+			level:     2,
+			provider:  &testProvider{req: Password{Command: CmdP2, Value: DataSet{Value: "ABCD"}, Level: 3}},
+			reply:     []byte{ack},
+			wantTx:    "\x01P2\x02(ABCD)\x03",
+			wantLevel: 3,
+		},
+		{
+			name:      "Requested level",
+			level:     2,
+			provider:  &testProvider{req: Password{Command: CmdP1, Value: DataSet{Value: "secret"}}},
+			reply:     []byte{ack},
+			wantTx:    "\x01P1\x02(secret)\x03",
+			wantLevel: 2,
+		},
+		{
+			name:      "Lower level",
+			level:     3,
+			provider:  &testProvider{req: Password{Command: CmdP1, Value: DataSet{Value: "secret"}, Level: 2}},
+			reply:     []byte{ack},
+			wantTx:    "\x01P1\x02(secret)\x03",
+			wantLevel: 2,
+			wantErr:   &AccessError{Command: CmdP1, Level: 2},
+		},
+		{
+			name:      "Rejected",
+			level:     2,
+			provider:  &testProvider{req: Password{Command: CmdP1, Value: DataSet{Value: "secret"}}},
+			reply:     []byte{nak, nak, nak, nak, nak},
+			wantTx:    "\x01P1\x02(secret)\x03",
+			wantLevel: 1,
+			wantErr:   ErrInvalidPassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.Write(tt.reply)
+			td := WithPasswordProvider(NewConn(&port, ConnOptions{}), "", tt.provider)
+			td.programmingMode = true
+			td.lastActivity = time.Now()
+			td.identity = &Identity{Manufacturer: "ABC", Mode: ModeC, bri: '5'}
+			td.accessLevel = 1
+			td.operand = DataSet{Value: "1234"}
+			err := td.Elevate(tt.level)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("Elevate() error = %v, want %v", err, tt.wantErr)
+			}
+			if td.PasswordLevel() != tt.wantLevel {
+				t.Errorf("PasswordLevel() = %v, want %v", td.PasswordLevel(), tt.wantLevel)
+			}
+			if tt.wantTx == "" {
+				return
+			}
+			if port.tx.Len() < len(tt.wantTx) || port.tx.String()[:len(tt.wantTx)] != tt.wantTx {
+				t.Errorf("sent %q, want %q", port.tx.Bytes(), tt.wantTx)
+			}
+			want := PasswordRequest{Identity: *td.identity, Operand: DataSet{Value: "1234"}, Level: tt.level}
+			if !reflect.DeepEqual(tt.provider.got, want) {
+				t.Errorf("Password() request = %+v, want %+v", tt.provider.got, want)
+			}
+		})
+	}
+}
+
+func TestTariffDevice_CommandAccessDenied(t *testing.T) {
+	reply := func(v string) []byte {
+		rv := []byte("\x02(" + v + ")\x03")
+		return append(rv, bcc(rv[1:]))
+	}
+	tests := []struct {
+		name    string
+		cmd     Command
+		reply   []byte
+		wantErr error
+	}{
+		{
+			name:    "Write refused",
+			cmd:     Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "120000"}},
+			reply:   reply("ERR04"),
+			wantErr: &AccessError{Command: CmdW1, Level: 1, Reply: "ERR04"},
+		},
+		{
+			name:    "Execute refused",
+			cmd:     Command{Id: CmdE2, Payload: &DataSet{Address: "C.1"}},
+			reply:   reply("ERR04"),
+			wantErr: &AccessError{Command: CmdE2, Level: 1, Reply: "ERR04"},
+		},
+		{
+			name:  "Other error",
+			cmd:   Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "120000"}},
+			reply: reply("ERR01"),
+		},
+		{
+			name:  "Read",
+			cmd:   Command{Id: CmdR1, Payload: &DataSet{Address: "0.9.1"}},
+			reply: reply("ERR04"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.Write(tt.reply)
+			td := NewTariffDevice(NewConn(&port, ConnOptions{}))
+			td.Quirks = &Quirks{AccessDenied: []string{"ERR04"}}
+			td.programmingMode = true
+			td.lastActivity = time.Now()
+			td.identity = &Identity{bri: '5'}
+			td.accessLevel = 1
+			db, err := td.Command(tt.cmd)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("Command() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInsufficientAccess) {
+					t.Error("error does not match ErrInsufficientAccess")
+				}
+				return
+			}
+			if db == nil || len(db.Lines) != 1 {
+				t.Errorf("Command() = %v", db)
+			}
+		})
+	}
+}
+
+func TestAccessError_Error(t *testing.T) {
+	err := &AccessError{Command: CmdW2, Level: 1, Reply: "ERR04"}
+	if err.Error() != "command W2 refused at access level 1: ERR04" {
+		t.Errorf("AccessError.Error() = %v", err)
+	}
+}
+
+func TestTariffDevice_ElevateSignOn(t *testing.T) {
+	p0 := []byte("P0\x02(1234)\x03")
+	var port serialPort
+	port.rx.WriteString("/ABC5dev\r\n")
+	port.rx.WriteByte(soh)
+	port.rx.Write(p0)
+	port.rx.WriteByte(bcc(p0))
+	port.rx.WriteByte(ack)
+	provider := &testProvider{req: Password{Command: CmdP1, Value: DataSet{Value: "secret"}}}
+	td := WithPasswordProvider(NewConn(&port, ConnOptions{}), "", provider)
+	td.SignOnLevel = 1
+	if err := td.Elevate(3); err != nil {
+		t.Fatal(err)
+	}
+	if provider.got.Level != 3 {
+		t.Errorf("Password() requested level = %v, want 3", provider.got.Level)
+	}
+	if td.PasswordLevel() != 3 || td.SignOnLevel != 1 {
+		t.Errorf("PasswordLevel() = %v, SignOnLevel = %v", td.PasswordLevel(), td.SignOnLevel)
+	}
+}
+
+func TestTariffDevice_SessionEndResetsLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(td *TariffDevice)
+	}{
+		{name: "SendBreak", fn: func(td *TariffDevice) { _ = td.SendBreak() }},
+		{name: "DropProgrammingMode", fn: func(td *TariffDevice) { td.DropProgrammingMode() }},
+		{name: "Handshake", fn: func(td *TariffDevice) { _, _ = td.ReadOut() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			td := NewTariffDevice(NewConn(&port, ConnOptions{}))
+			td.programmingMode = true
+			td.accessLevel = 3
+			tt.fn(td)
+			if td.PasswordLevel() != 0 {
+				t.Errorf("PasswordLevel() = %v, want 0", td.PasswordLevel())
+			}
+		})
+	}
+}
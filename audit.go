@@ -0,0 +1,194 @@
+package iec62056
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes a W1, W2 or E2 command passed to TariffDevice.Command.
+type AuditRecord struct {
+	// Time the command was sent or refused.
+	Time time.Time `json:"time"`
+	// Device address, empty for broadcast.
+	Address string `json:"address"`
+	// Identity of the device, nil if unknown.
+	Identity *Identity `json:"identity,omitempty"`
+	// Command identifier.
+	Command CommandId `json:"command"`
+	// Data set sent with the command, nil if Raw payload was sent.
+	Payload *DataSet `json:"payload,omitempty"`
+	// Manufacturer specific payload sent instead of Payload.
+	Raw string `json:"raw,omitempty"`
+	// Value of the address read before the command if TariffDevice.AuditPreRead is set.
+	Previous *DataSet `json:"previous,omitempty"`
+	// True if device acknowledged the command.
+	Ack bool `json:"ack"`
+	// Data message sent by device in reply, e.g. an error message.
+	Reply *DataBlock `json:"reply,omitempty"`
+	// Error of the command, e.g. policy or access refusal, invalid password or timeout.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink stores audit records.
+type AuditSink interface {
+	// Audit stores the record. The error is returned by TariffDevice.Command.
+	Audit(rec AuditRecord) error
+}
+
+// JSONLinesSink writes audit records as JSON objects separated by new lines.
+// It is safe for concurrent use.
+type JSONLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesSink creates a sink writing to w.
+// If w has Sync method, e.g. *os.File, it is called after every record.
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// OpenAuditFile opens or creates file name for appending audit records.
+func OpenAuditFile(name string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesSink(f), nil
+}
+
+// Audit writes rec as a single line.
+func (s *JSONLinesSink) Audit(rec AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.w.Write(data); err != nil {
+		return err
+	}
+	if f, ok := s.w.(interface{ Sync() error }); ok {
+		return f.Sync()
+	}
+	return nil
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (s *JSONLinesSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// auditCommand sends cmd and stores the audit record of the attempt.
+// If the sink fails then the reply is returned along with the sink error joined to the command error.
+func (t *TariffDevice) auditCommand(ctx context.Context, cmd Command) (*DataBlock, error) {
+	rec := AuditRecord{
+		Time:    time.Now(),
+		Address: t.address,
+		Command: cmd.Id,
+		Raw:     string(cmd.Raw),
+	}
+	if cmd.Payload != nil && cmd.Raw == nil {
+		ds := *cmd.Payload
+		rec.Payload = &ds
+	}
+	var db *DataBlock
+	err := t.prepareCommand(ctx, &cmd)
+	if t.identity != nil {
+		id := *t.identity
+		rec.Identity = &id
+	}
+	if err == nil {
+		if t.AuditPreRead && rec.Payload != nil && cmd.Id != CmdE2 {
+			rec.Previous = t.preRead(cmd.Id, rec.Payload.Address)
+		}
+		rec.Time = time.Now()
+		db, err = t.command(cmd)
+	}
+	switch {
+	case err != nil:
+		rec.Error = err.Error()
+	case len(db.Lines) == 0:
+		rec.Ack = true
+	default:
+		rec.Reply = db
+	}
+	if aerr := t.Audit.Audit(rec); aerr != nil {
+		return db, joinErrors(err, aerr)
+	}
+	return db, err
+}
+
+// joinError is the error of joinErrors.
+type joinError struct {
+	errs []error
+}
+
+// joinErrors returns an error that wraps non-nil errs, like errors.Join of Go 1.20.
+func joinErrors(errs ...error) error {
+	e := &joinError{}
+	for _, err := range errs {
+		if err != nil {
+			e.errs = append(e.errs, err)
+		}
+	}
+	switch len(e.errs) {
+	case 0:
+		return nil
+	case 1:
+		return e.errs[0]
+	}
+	return e
+}
+
+func (e *joinError) Error() string {
+	s := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e *joinError) Unwrap() []error {
+	return e.errs
+}
+
+// preRead reads the value of address before write command id.
+// It returns nil on failure and on error message replies.
+func (t *TariffDevice) preRead(id CommandId, address string) *DataSet {
+	read := CmdR1
+	if id == CmdW2 {
+		read = CmdR2
+	}
+	db, err := t.command(Command{Id: read, Payload: &DataSet{Address: address}})
+	if err != nil || len(db.Lines) == 0 || len(db.Lines[0].Sets) == 0 {
+		return nil
+	}
+	ds := db.Lines[0].Sets[0]
+	if ds.Address != "" && ds.Address != address || t.isErrorReply(ds.Value) {
+		return nil
+	}
+	ds.Address = address
+	return &ds
+}
+
+// isErrorReply reports whether data set value v of a reply is an error message.
+// IEC 62056-21 does not standardise error messages, only values listed
+// in Quirks.AccessDenied of the device are recognised.
+func (t *TariffDevice) isErrorReply(v string) bool {
+	for _, d := range t.quirks().AccessDenied {
+		if v == d {
+			return true
+		}
+	}
+	return false
+}
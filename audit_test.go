@@ -0,0 +1,254 @@
+package iec62056
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testSink struct {
+	recs []AuditRecord
+	err  error
+}
+
+func (s *testSink) Audit(rec AuditRecord) error {
+	s.recs = append(s.recs, rec)
+	return s.err
+}
+
+func TestTariffDevice_Audit(t *testing.T) {
+	message := func(v string) []byte {
+		rv := []byte("\x02(" + v + ")\x03")
+		return append(rv, bcc(rv[1:]))
+	}
+	errSink := errors.New("disk full")
+	id := Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, bri: '5'}
+	tests := []struct {
+		name     string
+		cmd      Command
+		preRead  bool
+		readOnly bool
+		quirks   *Quirks
+		reply    []byte
+		sinkErr  error
+		want     []AuditRecord
+		wantTx   string
+		wantErr  string
+	}{
+		{
+			name:  "Read is not audited",
+			cmd:   Command{Id: CmdR1, Payload: &DataSet{Address: "0.9.1"}},
+			reply: message("120000"),
+		},
+		{
+			name:   "Write acknowledged",
+			cmd:    Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "130000"}},
+			reply:  []byte{ack},
+			wantTx: "\x01W1\x020.9.1(130000)\x03",
+			want: []AuditRecord{{
+				Address: "7", Identity: &id, Command: CmdW1,
+				Payload: &DataSet{Address: "0.9.1", Value: "130000"}, Ack: true,
+			}},
+		},
+		{
+			name:    "Pre-read",
+			cmd:     Command{Id: CmdW2, Payload: &DataSet{Address: "0.9.2", Value: "210101"}},
+			preRead: true,
+			reply:   append(message("201231"), ack),
+			wantTx:  "\x01R2\x020.9.2()\x03",
+			want: []AuditRecord{{
+				Address: "7", Identity: &id, Command: CmdW2,
+				Payload:  &DataSet{Address: "0.9.2", Value: "210101"},
+				Previous: &DataSet{Address: "0.9.2", Value: "201231"}, Ack: true,
+			}},
+		},
+		{
+			name:    "Pre-read error message",
+			cmd:     Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "130000"}},
+			preRead: true,
+			quirks:  &Quirks{AccessDenied: []string{"ERR04"}},
+			reply:   append(message("ERR04"), ack),
+			wantTx:  "\x01R1\x020.9.1()\x03",
+			want: []AuditRecord{{
+				Address: "7", Identity: &id, Command: CmdW1,
+				Payload: &DataSet{Address: "0.9.1", Value: "130000"}, Ack: true,
+			}},
+		},
+		{
+			name:    "Execute is not pre-read",
+			cmd:     Command{Id: CmdE2, Payload: &DataSet{Address: "C.1"}},
+			preRead: true,
+			reply:   message("ERR"),
+			wantTx:  "\x01E2\x02C.1()\x03",
+			want: []AuditRecord{{
+				Address: "7", Identity: &id, Command: CmdE2, Payload: &DataSet{Address: "C.1"},
+				Reply: &DataBlock{Lines: []DataLine{{Sets: []DataSet{{Value: "ERR"}}}}},
+			}},
+		},
+		{
+			name:    "Sink error",
+			cmd:     Command{Id: CmdW1, Raw: []byte("X(1)")},
+			reply:   []byte{ack},
+			sinkErr: errSink,
+			want:    []AuditRecord{{Address: "7", Identity: &id, Command: CmdW1, Raw: "X(1)", Ack: true}},
+			wantErr: "disk full",
+		},
+		{
+			name: "Command error",
+			cmd:  Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "130000"}},
+			want: []AuditRecord{{
+				Address: "7", Identity: &id, Command: CmdW1,
+				Payload: &DataSet{Address: "0.9.1", Value: "130000"}, Error: "EOF",
+			}},
+			wantErr: "EOF",
+		},
+		{
+			name:    "Command and sink error",
+			cmd:     Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "130000"}},
+			sinkErr: errSink,
+			want: []AuditRecord{{
+				Address: "7", Identity: &id, Command: CmdW1,
+				Payload: &DataSet{Address: "0.9.1", Value: "130000"}, Error: "EOF",
+			}},
+			wantErr: "EOF\ndisk full",
+		},
+		{
+			name:     "Policy refusal",
+			cmd:      Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "130000"}},
+			readOnly: true,
+			want: []AuditRecord{{
+				Address: "7", Identity: &id, Command: CmdW1,
+				Payload: &DataSet{Address: "0.9.1", Value: "130000"},
+				Error:   "command W1 to 0.9.1 refused: read-only mode",
+			}},
+			wantErr: "command W1 to 0.9.1 refused: read-only mode",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.Write(tt.reply)
+			sink := &testSink{err: tt.sinkErr}
+			td := WithAddress(NewConn(&port, ConnOptions{}), "7")
+			td.Audit = sink
+			td.AuditPreRead = tt.preRead
+			td.ReadOnly = tt.readOnly
+			td.Quirks = tt.quirks
+			td.programmingMode = true
+			td.lastActivity = time.Now()
+			td.identity = &id
+			_, err := td.Command(tt.cmd)
+			if (err == nil) != (tt.wantErr == "") || err != nil && err.Error() != tt.wantErr {
+				t.Fatalf("Command() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.sinkErr != nil && !errors.Is(err, tt.sinkErr) {
+				t.Errorf("Command() error = %v, want wrapped %v", err, tt.sinkErr)
+			}
+			for i := range sink.recs {
+				if sink.recs[i].Time.IsZero() {
+					t.Error("record time is not set")
+				}
+				sink.recs[i].Time = time.Time{}
+			}
+			if !reflect.DeepEqual(sink.recs, tt.want) {
+				t.Errorf("records = %+v, want %+v", sink.recs, tt.want)
+			}
+			if !bytes.HasPrefix(port.tx.Bytes(), []byte(tt.wantTx)) {
+				t.Errorf("sent %q, want %q", port.tx.Bytes(), tt.wantTx)
+			}
+		})
+	}
+}
+
+func TestTariffDevice_AuditSignOnFailure(t *testing.T) {
+	p0 := []byte("P0\x02(1234)\x03")
+	var port serialPort
+	port.rx.WriteString("/ABC5dev\r\n")
+	port.rx.WriteByte(soh)
+	port.rx.Write(p0)
+	port.rx.WriteByte(bcc(p0))
+	port.rx.Write([]byte{nak, nak, nak, nak, nak})
+	sink := &testSink{}
+	td := WithPassword(NewConn(&port, ConnOptions{}), "", func(DataSet) (DataSet, CommandId) {
+		return DataSet{Value: "wrong"}, CmdP1
+	})
+	td.Audit = sink
+	_, err := td.Command(Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "130000"}})
+	if err != ErrInvalidPassword {
+		t.Fatalf("Command() error = %v, want %v", err, ErrInvalidPassword)
+	}
+	if len(sink.recs) != 1 || sink.recs[0].Error != ErrInvalidPassword.Error() || sink.recs[0].Payload == nil {
+		t.Errorf("records = %+v", sink.recs)
+	}
+}
+
+func TestJSONLinesSink_Audit(t *testing.T) {
+	rec := AuditRecord{
+		Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Address:  "7",
+		Identity: &Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, bri: '5'},
+		Command:  CmdW1,
+		Payload:  &DataSet{Address: "0.9.1", Value: "130000"},
+		Previous: &DataSet{Address: "0.9.1", Value: "120000"},
+		Ack:      true,
+	}
+	var buf bytes.Buffer
+	s := NewJSONLinesSink(&buf)
+	if err := s.Audit(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Audit(rec); err != nil {
+		t.Fatal(err)
+	}
+	line := `{"time":"2024-05-01T12:00:00Z","address":"7",` +
+		`"identity":{"manufacturer":"ABC","device":"dev","mode":"C","baudRate":9600},"command":"W1",` +
+		`"payload":{"address":"0.9.1","value":"130000"},"previous":{"address":"0.9.1","value":"120000"},"ack":true}` + "\n"
+	if buf.String() != line+line {
+		t.Errorf("Audit() wrote %s", buf.String())
+	}
+	var got AuditRecord
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatal(err)
+	}
+	got.Identity.bri = '5'
+	if !reflect.DeepEqual(got, rec) {
+		t.Errorf("decoded %+v, want %+v", got, rec)
+	}
+	data, err := json.Marshal(AuditRecord{Command: CmdW1, Raw: "X(1)"})
+	if err != nil || bytes.Contains(data, []byte("payload")) {
+		t.Errorf("raw record = %s, %v", data, err)
+	}
+	reserved := &Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, bri: '8'}
+	data, err = json.Marshal(AuditRecord{Command: CmdW1, Identity: reserved})
+	if err != nil || !bytes.Contains(data, []byte(`"baudChar":"8"`)) {
+		t.Errorf("reserved baud rate record = %s, %v", data, err)
+	}
+}
+
+func TestOpenAuditFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < 2; i++ {
+		s, err := OpenAuditFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Audit(AuditRecord{Command: CmdE2}); err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 2 {
+		t.Errorf("file has %v lines, want 2", n)
+	}
+}
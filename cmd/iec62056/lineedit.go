@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// errInterrupt is returned on Ctrl-C.
+var errInterrupt = errors.New("interrupted")
+
+// terminal control keys.
+const (
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyTab       = 0x09
+	keyLF        = 0x0a
+	keyCR        = 0x0d
+	keyCtrlU     = 0x15
+	keyEsc       = 0x1b
+	keyBackspace = 0x7f
+	keyCtrlH     = 0x08
+)
+
+// lineEditor reads lines with history and tab completion on raw terminals
+// and falls back to plain line reading otherwise.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	// raw terminal mode is active
+	raw bool
+	// entered lines, oldest first
+	history []string
+	// returns completion candidates for the last word of line
+	complete func(line string) []string
+}
+
+// readLine prints prompt and reads a line. Non-empty lines are added to history if remember is set.
+// It returns io.EOF on Ctrl-D at empty line and errInterrupt on Ctrl-C.
+func (e *lineEditor) readLine(prompt string, remember bool) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	var line string
+	var err error
+	if e.raw {
+		line, err = e.edit(prompt)
+	} else {
+		line, err = e.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		line = strings.TrimSpace(line)
+	}
+	if err != nil {
+		return "", err
+	}
+	if remember && line != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+		e.history = append(e.history, line)
+	}
+	return line, nil
+}
+
+// edit reads key presses until enter.
+func (e *lineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := len(e.history)
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r\x1b[K%s%s", prompt, string(buf))
+	}
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case keyCR, keyLF:
+			fmt.Fprint(e.out, "\r\n")
+			return strings.TrimSpace(string(buf)), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case keyBackspace, keyCtrlH:
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+				redraw()
+			}
+		case keyCtrlU:
+			buf = buf[:0]
+			redraw()
+		case keyTab:
+			buf = e.completeLine(buf, prompt)
+			redraw()
+		case keyEsc:
+			seq, err := e.escape()
+			if err != nil {
+				return "", err
+			}
+			switch {
+			case seq == 'A' && pos > 0:
+				pos--
+			case seq == 'B' && pos < len(e.history):
+				pos++
+			default:
+				continue
+			}
+			buf = buf[:0]
+			if pos < len(e.history) {
+				buf = append(buf, []rune(e.history[pos])...)
+			}
+			redraw()
+		default:
+			if r >= ' ' {
+				buf = append(buf, r)
+				fmt.Fprint(e.out, string(r))
+			}
+		}
+	}
+}
+
+// escape reads a CSI escape sequence and returns its final byte.
+func (e *lineEditor) escape() (byte, error) {
+	b, err := e.in.ReadByte()
+	if err != nil || b != '[' {
+		return 0, err
+	}
+	for {
+		b, err = e.in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b >= 0x40 && b <= 0x7e {
+			return b, nil
+		}
+	}
+}
+
+// completeLine completes the last word of buf or prints candidates if the choice is ambiguous.
+func (e *lineEditor) completeLine(buf []rune, prompt string) []rune {
+	if e.complete == nil {
+		return buf
+	}
+	line := string(buf)
+	candidates := e.complete(line)
+	if len(candidates) == 0 {
+		return buf
+	}
+	word := line[strings.LastIndexByte(line, ' ')+1:]
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		prefix += " "
+	} else if len(prefix) <= len(word) {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+	return []rune(line[:len(line)-len(word)] + prefix)
+}
+
+// commonPrefix returns the longest common prefix of sorted words.
+func commonPrefix(words []string) string {
+	sort.Strings(words)
+	first, last := words[0], words[len(words)-1]
+	i := 0
+	for i < len(first) && i < len(last) && first[i] == last[i] {
+		i++
+	}
+	return first[:i]
+}
@@ -0,0 +1,312 @@
+// Command iec62056 reads and programs tariff devices using IEC 62056-21 protocol.
+//
+// Usage:
+//
+//	iec62056 [flags] <command> [arguments]
+//
+// Commands:
+//
+//	identity                 print device identification
+//	readout                  read out data message
+//	option <0-9>             select an option and print the reply
+//	read <address>           read register (R1, R2 with -level 2)
+//	write <address> <value>  write register (W1, W2 with -level 2)
+//	exec <address> [value]   execute function (E2)
+//	break                    send break command
+//	shell                    interactive programming mode session
+//
+// Run iec62056 -h for the flags.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/srgsf/iec62056.golang"
+)
+
+// options contains parsed command line flags.
+type options struct {
+	// transport endpoint, "host:port" or unix socket path
+	socket string
+	// transport name
+	transport string
+	// skip tls certificate verification
+	insecure bool
+	// device address
+	address string
+	// clear text password
+	password string
+	// software parity translation
+	parity bool
+	// read back echoed request bytes
+	echo bool
+	// link baud rate limit
+	maxBaud int
+	// refuse W and E commands
+	readOnly bool
+	// audit file of W and E commands
+	audit string
+	// connection timeout
+	connectTimeout time.Duration
+	// frame i/o timeout
+	timeout time.Duration
+	// output format
+	format string
+	// command level for read, write
+	level int
+	// skip shell confirmations
+	yes bool
+	// shell keep alive interval
+	keepalive time.Duration
+	// register read by shell keep alive requests
+	keepaliveRegister string
+}
+
+// dial connects to the device. Replaced in tests.
+var dial = func(o *options, logger *log.Logger) (iec62056.Conn, error) {
+	d := iec62056.TCPDialer{
+		ConnectionTimeOut: o.connectTimeout,
+		RWTimeOut:         o.timeout,
+		ProtocolLogger:    logger,
+		SwParity:          o.parity,
+		Echo:              o.echo,
+	}
+	switch o.transport {
+	case "tcp":
+	case "unix":
+		d.DialFunc = func(ctx context.Context, _, address string) (net.Conn, error) {
+			var nd net.Dialer
+			return nd.DialContext(ctx, "unix", address)
+		}
+	case "tls":
+		td := tls.Dialer{Config: &tls.Config{InsecureSkipVerify: o.insecure}} //nolint:gosec // explicit user choice
+		d.DialFunc = td.DialContext
+	default:
+		return nil, fmt.Errorf("unknown transport %q", o.transport)
+	}
+	return d.Dial(o.socket)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes command line and returns process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var o options
+	fs := flag.NewFlagSet("iec62056", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&o.socket, "socket", "", "device endpoint: host:port for tcp and tls, path for unix")
+	fs.StringVar(&o.transport, "transport", "tcp", "transport: tcp, tls or unix")
+	fs.BoolVar(&o.insecure, "insecure", false, "skip tls certificate verification")
+	fs.StringVar(&o.address, "address", "", "device address, empty for broadcast")
+	fs.StringVar(&o.password, "password", "", "password sent with P1 command on entering programming mode")
+	fs.BoolVar(&o.parity, "parity", false, "apply software even parity translation (7E1 over 8N1 transport)")
+	fs.BoolVar(&o.echo, "echo", false, "discard echo of sent frames produced by half-duplex or optical interfaces")
+	fs.IntVar(&o.maxBaud, "max-baud", 0, "maximum baud rate requested in mode C option select, 0 accepts device offer")
+	fs.BoolVar(&o.readOnly, "read-only", false, "refuse W and E commands before they are sent")
+	fs.StringVar(&o.audit, "audit", "", "append JSON lines records of W and E commands to file")
+	fs.DurationVar(&o.connectTimeout, "connect-timeout", 5*time.Second, "connection timeout")
+	fs.DurationVar(&o.timeout, "timeout", 5*time.Second, "frame read and write timeout")
+	fs.StringVar(&o.format, "format", "table", "output format: table, json, csv or raw")
+	fs.IntVar(&o.level, "level", 1, "command level for read and write: 1 or 2")
+	fs.BoolVar(&o.yes, "yes", false, "shell: do not ask for confirmation before W and E commands")
+	fs.DurationVar(&o.keepalive, "keepalive", time.Minute, "shell: keep programming mode alive by reading a register when idle, 0 disables")
+	fs.StringVar(&o.keepaliveRegister, "keepalive-register", "0.0.0", "shell: register read to keep programming mode alive")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: iec62056 [flags] <command> [arguments]\n\n%s\nFlags:\n", commandsUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := execute(&o, fs.Args(), stdin, stdout); err != nil {
+		fmt.Fprintln(stderr, "iec62056:", err)
+		return 1
+	}
+	return 0
+}
+
+const commandsUsage = `Commands:
+  identity                 print device identification
+  readout                  read out data message
+  option <0-9>             select an option and print the reply
+  read <address>           read register (R1, R2 with -level 2)
+  write <address> <value>  write register (W1, W2 with -level 2)
+  exec <address> [value]   execute function (E2)
+  break                    send break command
+  shell                    interactive programming mode session
+`
+
+var errUsage = errors.New("invalid arguments, run with -h for usage")
+
+// execute connects to the device and runs the command.
+func execute(o *options, args []string, stdin io.Reader, stdout io.Writer) error {
+	out, err := newPrinter(o.format, stdout)
+	if err != nil {
+		return err
+	}
+	shell := args[0] == "shell"
+	var cmd command
+	if shell {
+		if len(args) != 1 {
+			return errUsage
+		}
+		// frames are toggled by the shell, results are always printed
+		out = tablePrinter{stdout}
+		if o.format == "json" {
+			out = jsonPrinter{stdout}
+		}
+	} else if cmd, err = parseCommand(args, o.level); err != nil {
+		return err
+	}
+	if o.socket == "" {
+		return errors.New("-socket is required")
+	}
+
+	frames := &switchWriter{w: stdout, on: o.format == "raw"}
+	conn, err := dial(o, log.New(frames, "", 0))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	td := iec62056.WithPassword(conn, o.address, passwordFunc(o.password))
+	td.MaxBaudRate = o.maxBaud
+	td.ReadOnly = o.readOnly
+	if o.audit != "" {
+		sink, err := iec62056.OpenAuditFile(o.audit)
+		if err != nil {
+			return err
+		}
+		defer sink.Close()
+		td.Audit = sink
+	}
+	if shell {
+		return startShell(td, o, stdin, stdout, out, frames)
+	}
+	return cmd(td, out)
+}
+
+// passwordFunc returns clear text password callback or nil.
+func passwordFunc(password string) iec62056.PasswordFunc {
+	if password == "" {
+		return nil
+	}
+	return func(iec62056.DataSet) (iec62056.DataSet, iec62056.CommandId) {
+		return iec62056.DataSet{Value: password}, iec62056.CmdP1
+	}
+}
+
+// command is a parsed command line command.
+type command func(td *iec62056.TariffDevice, out printer) error
+
+// parseCommand validates arguments and returns command to execute.
+func parseCommand(args []string, level int) (command, error) {
+	if level != 1 && level != 2 {
+		return nil, errors.New("-level must be 1 or 2")
+	}
+	name, args := args[0], args[1:]
+	argc := map[string][2]int{
+		"identity": {0, 0},
+		"readout":  {0, 0},
+		"option":   {1, 1},
+		"read":     {1, 1},
+		"write":    {2, 2},
+		"exec":     {1, 2},
+		"break":    {0, 0},
+	}
+	n, ok := argc[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown command %q", name)
+	}
+	if len(args) < n[0] || len(args) > n[1] {
+		return nil, errUsage
+	}
+
+	switch name {
+	case "identity":
+		return func(td *iec62056.TariffDevice, out printer) error {
+			id, err := td.Identity()
+			if err != nil {
+				return err
+			}
+			return out.identity(id)
+		}, nil
+	case "readout":
+		return func(td *iec62056.TariffDevice, out printer) error {
+			db, err := td.ReadOut()
+			if err != nil {
+				return err
+			}
+			return out.dataBlock(db)
+		}, nil
+	case "option":
+		if len(args[0]) != 1 || args[0][0] < '0' || args[0][0] > '9' {
+			return nil, fmt.Errorf("invalid option %q", args[0])
+		}
+		o := iec62056.OptionSelectMessage{
+			Option: iec62056.Option(args[0][0]),
+			PCC:    iec62056.NormalPCC,
+		}
+		return func(td *iec62056.TariffDevice, out printer) error {
+			db, err := td.Option(o)
+			if err != nil {
+				return err
+			}
+			return out.dataBlock(db)
+		}, nil
+	case "break":
+		return func(td *iec62056.TariffDevice, _ printer) error {
+			return td.SendBreak()
+		}, nil
+	}
+
+	cmd := iec62056.Command{Payload: &iec62056.DataSet{Address: args[0]}}
+	switch name {
+	case "read":
+		cmd.Id = iec62056.CmdR1
+		if level == 2 {
+			cmd.Id = iec62056.CmdR2
+		}
+	case "write":
+		cmd.Id = iec62056.CmdW1
+		if level == 2 {
+			cmd.Id = iec62056.CmdW2
+		}
+	case "exec":
+		cmd.Id = iec62056.CmdE2
+	}
+	if len(args) > 1 {
+		cmd.Payload.Value, cmd.Payload.Unit = splitValue(args[1])
+	}
+	return func(td *iec62056.TariffDevice, out printer) error {
+		db, err := td.Command(cmd)
+		if err != nil {
+			return err
+		}
+		return out.dataBlock(db)
+	}, nil
+}
+
+// splitValue splits "value*unit" argument.
+func splitValue(s string) (string, string) {
+	if i := strings.IndexByte(s, '*'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/srgsf/iec62056.golang"
+	"github.com/srgsf/iec62056.golang/iectest"
+)
+
+// script sets up dial to return an in-memory connection to the meter.
+func script(t *testing.T) *iectest.Meter {
+	conn, meter := iectest.Pipe()
+	dial = func(*options, *log.Logger) (iec62056.Conn, error) {
+		return conn, nil
+	}
+	t.Cleanup(func() {
+		if err := meter.Wait(); err != nil {
+			t.Error(err)
+		}
+	})
+	return meter
+}
+
+func TestRun(t *testing.T) {
+	p0 := iectest.Command(iec62056.Command{Id: iec62056.CmdP0, Payload: &iec62056.DataSet{Value: "123"}})
+	tests := []struct {
+		name     string
+		args     []string
+		setup    func(m *iectest.Meter)
+		want     string
+		wantCode int
+	}{
+		{
+			name: "identity",
+			args: []string{"-socket", "x", "identity"},
+			setup: func(m *iectest.Meter) {
+				m.Expect(iectest.Request("")).Reply(iectest.Identity("ABC5dev"))
+			},
+			want: "Manufacturer  ABC\nDevice        dev\nMode          C\nBaud rate     9600\n",
+		},
+		{
+			name: "readout json",
+			args: []string{"-socket", "x", "-address", "12", "-format", "json", "readout"},
+			setup: func(m *iectest.Meter) {
+				m.Expect(iectest.Request("12")).Reply(iectest.Identity("ABC5dev"))
+				m.Expect(iectest.OptionSelect(iec62056.NormalPCC, '5', iec62056.DataReadOut)).
+					Reply(iectest.DataMessage("1.8.0(12.5*kWh)\r\n!\r\n"))
+			},
+			want: `[
+  [
+    {
+      "address": "1.8.0",
+      "value": "12.5",
+      "unit": "kWh"
+    }
+  ]
+]
+`,
+		},
+		{
+			name: "write with password",
+			args: []string{"-socket", "x", "-password", "secret", "write", "0.9.1", "123000"},
+			setup: func(m *iectest.Meter) {
+				m.Expect(iectest.Request("")).Reply(iectest.Identity("ABC5dev"))
+				m.Expect(iectest.OptionSelect(iec62056.NormalPCC, '5', iec62056.ProgrammingMode)).Reply(p0)
+				m.Expect(iectest.Command(iec62056.Command{
+					Id:      iec62056.CmdP1,
+					Payload: &iec62056.DataSet{Value: "secret"},
+				})).Reply(iectest.Ack())
+				m.Expect(iectest.Command(iec62056.Command{
+					Id:      iec62056.CmdW1,
+					Payload: &iec62056.DataSet{Address: "0.9.1", Value: "123000"},
+				})).Reply(iectest.Ack())
+			},
+			want: "ADDRESS  VALUE  UNIT\n",
+		},
+		{
+			name: "read csv",
+			args: []string{"-socket", "x", "-format", "csv", "read", "1.8.0"},
+			setup: func(m *iectest.Meter) {
+				m.Expect(iectest.Request("")).Reply(iectest.Identity("ABC5dev"))
+				m.Expect(iectest.OptionSelect(iec62056.NormalPCC, '5', iec62056.ProgrammingMode)).Reply(p0)
+				m.Expect(iectest.Command(iec62056.Command{
+					Id:      iec62056.CmdR1,
+					Payload: &iec62056.DataSet{Address: "1.8.0"},
+				})).Reply(iectest.DataMessage("1.8.0(12.5*kWh)\r\n"))
+			},
+			want: "address,value,unit\n1.8.0,12.5,kWh\n",
+		},
+		{
+			name:     "unknown command",
+			args:     []string{"-socket", "x", "erase"},
+			wantCode: 1,
+		},
+		{
+			name:     "missing arguments",
+			args:     []string{"-socket", "x", "write", "0.9.1"},
+			wantCode: 1,
+		},
+		{
+			name:     "no command",
+			args:     []string{},
+			wantCode: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := script(t)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+			m.Start()
+			var stdout, stderr bytes.Buffer
+			code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("run() = %v, want %v, stderr: %s", code, tt.wantCode, stderr.String())
+			}
+			if got := stdout.String(); tt.wantCode == 0 && got != tt.want {
+				t.Errorf("run() output:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitValue(t *testing.T) {
+	v, u := splitValue("12*kWh")
+	if v != "12" || u != "kWh" {
+		t.Errorf("splitValue() = %v, %v", v, u)
+	}
+	if v, u = splitValue("12"); v != "12" || u != "" {
+		t.Errorf("splitValue() = %v, %v", v, u)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/srgsf/iec62056.golang"
+)
+
+// printer writes command results.
+type printer interface {
+	identity(id iec62056.Identity) error
+	dataBlock(db *iec62056.DataBlock) error
+}
+
+// newPrinter creates printer for the output format.
+func newPrinter(format string, w io.Writer) (printer, error) {
+	switch format {
+	case "table":
+		return tablePrinter{w}, nil
+	case "json":
+		return jsonPrinter{w}, nil
+	case "csv":
+		return csvPrinter{iec62056.NewCSVWriter(w), w}, nil
+	case "raw":
+		// frames are written by protocol logger
+		return rawPrinter{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// tablePrinter writes aligned columns.
+type tablePrinter struct {
+	w io.Writer
+}
+
+func (p tablePrinter) identity(id iec62056.Identity) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	if name := id.ManufacturerName(); name != "" {
+		fmt.Fprintf(tw, "Manufacturer\t%s (%s)\n", id.Manufacturer, name)
+	} else {
+		fmt.Fprintf(tw, "Manufacturer\t%s\n", id.Manufacturer)
+	}
+	fmt.Fprintf(tw, "Device\t%s\n", id.Device)
+	fmt.Fprintf(tw, "Mode\t%c\n", id.Mode)
+	if rate, err := id.BaudRate(); err == nil {
+		fmt.Fprintf(tw, "Baud rate\t%d\n", rate)
+	} else {
+		fmt.Fprintf(tw, "Baud rate\treserved (%c)\n", id.BaudChar())
+	}
+	return tw.Flush()
+}
+
+func (p tablePrinter) dataBlock(db *iec62056.DataBlock) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDRESS\tVALUE\tUNIT")
+	if db != nil {
+		for _, l := range db.Lines {
+			for _, ds := range l.Sets {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", ds.Address, ds.Value, ds.Unit)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// jsonPrinter writes json documents.
+type jsonPrinter struct {
+	w io.Writer
+}
+
+func (p jsonPrinter) identity(id iec62056.Identity) error {
+	return p.encode(id)
+}
+
+func (p jsonPrinter) dataBlock(db *iec62056.DataBlock) error {
+	if db == nil {
+		db = &iec62056.DataBlock{}
+	}
+	return p.encode(db)
+}
+
+func (p jsonPrinter) encode(v interface{}) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// csvPrinter writes data sets as csv rows.
+type csvPrinter struct {
+	csv *iec62056.CSVWriter
+	w   io.Writer
+}
+
+func (p csvPrinter) identity(id iec62056.Identity) error {
+	text, err := id.MarshalText()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(p.w, "%s\n", text)
+	return err
+}
+
+func (p csvPrinter) dataBlock(db *iec62056.DataBlock) error {
+	return p.csv.Write(db)
+}
+
+// rawPrinter prints nothing, frames are dumped by protocol logger.
+type rawPrinter struct{}
+
+func (rawPrinter) identity(iec62056.Identity) error {
+	return nil
+}
+
+func (rawPrinter) dataBlock(*iec62056.DataBlock) error {
+	return nil
+}
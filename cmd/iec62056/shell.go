@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/srgsf/iec62056.golang"
+)
+
+const shellHelp = `Commands:
+  <id> <address> [value[*unit]]  send command, e.g. r1 1.8.0 or w1 0.9.1 123000
+  <id> <address>(value[*unit])   send command with data set, e.g. e2 0.9.1(123000)
+  p1 <password>                  send password
+  break                          send break command and leave programming mode
+  frames [on|off]                toggle frame dumps
+  history                        print entered commands
+  help                           print this help
+  quit                           send break command and exit
+`
+
+// shell words completed besides command identifiers.
+var shellWords = []string{"break", "frames", "help", "history", "quit"}
+
+// switchWriter passes writes to w when enabled and discards them otherwise.
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	on bool
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.on {
+		return len(p), nil
+	}
+	return s.w.Write(p)
+}
+
+// set enables or disables writes and returns previous state.
+func (s *switchWriter) set(on bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rv := s.on
+	s.on = on
+	return rv
+}
+
+// shell is an interactive programming mode session.
+type shell struct {
+	// guards td between commands and keep alive requests
+	mu sync.Mutex
+	td *iec62056.TariffDevice
+	// line input
+	editor *lineEditor
+	// results printer
+	out printer
+	// shell messages output
+	w io.Writer
+	// frame dumps switch
+	frames *switchWriter
+	// ask for confirmation before W and E commands
+	confirm bool
+	// interval of keep alive requests, 0 disables them
+	keepalive time.Duration
+	// register read to keep programming mode alive
+	keepaliveRegister string
+	// last request time
+	lastActivity time.Time
+}
+
+// newShell creates a shell reading commands from in.
+func newShell(td *iec62056.TariffDevice, in io.Reader, w io.Writer, out printer, frames *switchWriter) *shell {
+	e := &lineEditor{
+		in:       bufio.NewReader(in),
+		out:      w,
+		complete: completeShell,
+	}
+	return &shell{
+		td:      td,
+		editor:  e,
+		out:     out,
+		w:       w,
+		frames:  frames,
+		confirm: true,
+	}
+}
+
+// completeShell returns completion candidates for the last word of line.
+func completeShell(line string) []string {
+	fields := strings.Fields(line)
+	if strings.HasSuffix(line, " ") {
+		fields = append(fields, "")
+	}
+	var words []string
+	switch {
+	case len(fields) <= 1:
+		for id := iec62056.CmdP0; id <= iec62056.CmdB0; id++ {
+			words = append(words, strings.ToLower(id.String()))
+		}
+		words = append(words, shellWords...)
+	case len(fields) == 2 && fields[0] == "frames":
+		words = []string{"on", "off"}
+	default:
+		return nil
+	}
+	var prefix string
+	if len(fields) > 0 {
+		prefix = strings.ToLower(fields[len(fields)-1])
+	}
+	var rv []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			rv = append(rv, w)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// run signs on and processes commands until quit or end of input.
+func (s *shell) run() error {
+	if err := s.do(s.td.SignOn); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.w, "programming mode entered, type help for commands")
+
+	if s.keepalive > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go s.keepAlive(done)
+	}
+
+	for {
+		line, err := s.editor.readLine("iec62056> ", true)
+		if err == errInterrupt {
+			continue
+		}
+		if err == io.EOF {
+			return s.do(s.td.SendBreak)
+		}
+		if err != nil {
+			return err
+		}
+		quit, err := s.exec(line)
+		if err != nil {
+			fmt.Fprintln(s.w, "error:", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// do runs f holding the device lock and updates activity time.
+func (s *shell) do(f func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := f()
+	s.lastActivity = time.Now()
+	return err
+}
+
+// keepAlive periodically reads keep alive register while the shell is idle.
+func (s *shell) keepAlive(done <-chan struct{}) {
+	t := time.NewTicker(s.keepalive / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		s.mu.Lock()
+		if s.td.InProgrammingMode() && time.Since(s.lastActivity) >= s.keepalive {
+			frames := s.frames.set(false)
+			_, _ = s.td.Command(iec62056.Command{
+				Id:      iec62056.CmdR1,
+				Payload: &iec62056.DataSet{Address: s.keepaliveRegister},
+			})
+			s.frames.set(frames)
+			s.lastActivity = time.Now()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// exec executes a shell line. It returns true if the shell should exit.
+func (s *shell) exec(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	switch strings.ToLower(fields[0]) {
+	case "quit", "exit":
+		return true, s.do(s.td.SendBreak)
+	case "help":
+		fmt.Fprint(s.w, shellHelp)
+		return false, nil
+	case "history":
+		for i, h := range s.editor.history {
+			fmt.Fprintf(s.w, "%4d  %s\n", i+1, h)
+		}
+		return false, nil
+	case "frames":
+		on := len(fields) == 1 || fields[1] == "on"
+		s.frames.set(on)
+		fmt.Fprintf(s.w, "frame dumps %s\n", map[bool]string{true: "on", false: "off"}[on])
+		return false, nil
+	case "break":
+		return false, s.do(s.td.SendBreak)
+	}
+
+	cmd, err := parseShellCommand(fields)
+	if err != nil {
+		return false, err
+	}
+	if s.confirm && isModifying(cmd.Id) {
+		ok, err := s.ask(cmd)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	var db *iec62056.DataBlock
+	err = s.do(func() error {
+		var err error
+		db, err = s.td.Command(cmd)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if db == nil || len(db.Lines) == 0 {
+		fmt.Fprintln(s.w, "ok")
+		return false, nil
+	}
+	return false, s.out.dataBlock(db)
+}
+
+// ask requests confirmation of a command.
+func (s *shell) ask(cmd iec62056.Command) (bool, error) {
+	payload, err := cmd.Payload.MarshalBinary()
+	if err != nil {
+		return false, err
+	}
+	answer, err := s.editor.readLine(fmt.Sprintf("send %s %s? [y/N] ", cmd.Id, payload), false)
+	if err == errInterrupt {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// isModifying reports whether command changes device state.
+func isModifying(id iec62056.CommandId) bool {
+	return id == iec62056.CmdW1 || id == iec62056.CmdW2 || id == iec62056.CmdE2
+}
+
+// parseShellCommand parses "<id> <address> [value]", "<id> <address>(value)" or "p1 <password>".
+func parseShellCommand(fields []string) (iec62056.Command, error) {
+	id, err := iec62056.ParseCommandId(fields[0])
+	if err != nil {
+		return iec62056.Command{}, fmt.Errorf("unknown command %q, type help for commands", fields[0])
+	}
+	cmd := iec62056.Command{Id: id}
+	args := fields[1:]
+	if id == iec62056.CmdB0 {
+		if len(args) != 0 {
+			return cmd, errUsage
+		}
+		return cmd, nil
+	}
+	var ds iec62056.DataSet
+	switch {
+	case len(args) == 0:
+		return cmd, errors.New("data set is missing")
+	case strings.ContainsRune(args[0], '('):
+		if err = ds.UnmarshalBinary([]byte(strings.Join(args, " "))); err != nil {
+			return cmd, err
+		}
+	case id == iec62056.CmdP0 || id == iec62056.CmdP1 || id == iec62056.CmdP2:
+		if len(args) != 1 {
+			return cmd, errUsage
+		}
+		ds.Value = args[0]
+	case len(args) > 2:
+		return cmd, errUsage
+	default:
+		ds.Address = args[0]
+		if len(args) == 2 {
+			ds.Value, ds.Unit = splitValue(args[1])
+		}
+	}
+	cmd.Payload = &ds
+	return cmd, nil
+}
+
+// startShell runs the shell on stdin switching the terminal into raw mode when possible.
+func startShell(td *iec62056.TariffDevice, o *options, stdin io.Reader, stdout io.Writer, out printer, frames *switchWriter) error {
+	s := newShell(td, stdin, stdout, out, frames)
+	s.confirm = !o.yes
+	s.keepalive = o.keepalive
+	s.keepaliveRegister = o.keepaliveRegister
+	if f, ok := stdin.(*os.File); ok {
+		if restore, err := makeRaw(f); err == nil {
+			defer restore()
+			s.editor.raw = true
+		}
+	}
+	return s.run()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/srgsf/iec62056.golang"
+	"github.com/srgsf/iec62056.golang/iectest"
+)
+
+func TestShell(t *testing.T) {
+	conn, meter := iectest.Pipe()
+	p0 := iectest.Command(iec62056.Command{Id: iec62056.CmdP0, Payload: &iec62056.DataSet{Value: "1"}})
+	meter.Expect(iectest.Request("")).Reply(iectest.Identity("ABC5dev"))
+	meter.Expect(iectest.OptionSelect(iec62056.NormalPCC, '5', iec62056.ProgrammingMode)).Reply(p0)
+	meter.Expect(iectest.Command(iec62056.Command{
+		Id:      iec62056.CmdR1,
+		Payload: &iec62056.DataSet{Address: "1.8.0"},
+	})).Reply(iectest.DataMessage("(12.5*kWh)\r\n"))
+	meter.Expect(iectest.Command(iec62056.Command{
+		Id:      iec62056.CmdW1,
+		Payload: &iec62056.DataSet{Address: "0.9.1", Value: "5"},
+	})).Reply(iectest.Ack())
+	meter.Expect(iectest.Break())
+	meter.Start()
+
+	input := "r1 1.8.0\nw1 0.9.1 7\nn\nw1 0.9.1(5)\ny\nx1 1\nhistory\nquit\n"
+	var out bytes.Buffer
+	s := newShell(iec62056.NewTariffDevice(conn), strings.NewReader(input), &out, tablePrinter{&out}, &switchWriter{})
+	if err := s.run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := meter.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"12.5   kWh",
+		"send W1 0.9.1(7)? [y/N]",
+		"ok\n",
+		`unknown command "x1"`,
+		"   2  w1 0.9.1 7\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("shell output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func Test_completeShell(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", []string{"b0", "break", "e2", "frames", "help", "history", "p0", "p1", "p2", "quit", "r1", "r2", "w1", "w2"}},
+		{"r", []string{"r1", "r2"}},
+		{"H", []string{"help", "history"}},
+		{"frames o", []string{"off", "on"}},
+		{"r1 1.", nil},
+	}
+	for _, tt := range tests {
+		if got := completeShell(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("completeShell(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func Test_lineEditor(t *testing.T) {
+	var out bytes.Buffer
+	e := &lineEditor{
+		in:       bufio.NewReader(strings.NewReader("hi\tx\x7f\r\x1b[A\x1b[A\x1b[B\r\x03\x04")),
+		out:      &out,
+		raw:      true,
+		history:  []string{"r1 1"},
+		complete: completeShell,
+	}
+	line, err := e.readLine("> ", true)
+	if err != nil || line != "history" {
+		t.Errorf("readLine() = %q, %v", line, err)
+	}
+	line, err = e.readLine("> ", true)
+	if err != nil || line != "history" {
+		t.Errorf("readLine() with history = %q, %v", line, err)
+	}
+	if _, err = e.readLine("> ", true); err != errInterrupt {
+		t.Errorf("readLine() error = %v, want %v", err, errInterrupt)
+	}
+	if _, err = e.readLine("> ", true); err == nil {
+		t.Error("readLine() expected EOF")
+	}
+	if !reflect.DeepEqual(e.history, []string{"r1 1", "history"}) {
+		t.Errorf("history = %v", e.history)
+	}
+}
+
+func Test_parseShellCommand(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    iec62056.Command
+		wantErr bool
+	}{
+		{"r1 1.8.0", iec62056.Command{Id: iec62056.CmdR1, Payload: &iec62056.DataSet{Address: "1.8.0"}}, false},
+		{"W2 0.9.1 5*kWh", iec62056.Command{Id: iec62056.CmdW2, Payload: &iec62056.DataSet{Address: "0.9.1", Value: "5", Unit: "kWh"}}, false},
+		{"e2 C.1(1)", iec62056.Command{Id: iec62056.CmdE2, Payload: &iec62056.DataSet{Address: "C.1", Value: "1"}}, false},
+		{"p1 secret", iec62056.Command{Id: iec62056.CmdP1, Payload: &iec62056.DataSet{Value: "secret"}}, false},
+		{"b0", iec62056.Command{Id: iec62056.CmdB0}, false},
+		{"r1", iec62056.Command{}, true},
+		{"r1 a b c", iec62056.Command{}, true},
+		{"z9 a", iec62056.Command{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseShellCommand(strings.Fields(tt.line))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseShellCommand(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseShellCommand(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
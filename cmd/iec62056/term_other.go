@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw is not supported, the shell falls back to line input without completion.
+func makeRaw(*os.File) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
@@ -0,0 +1,275 @@
+package iec62056
+
+import (
+	"bufio"
+	"io"
+)
+
+// Decoder reads a data message from a connection and yields data lines as they are received.
+// The block check character is calculated incrementally and verified at the end of the message.
+type Decoder struct {
+	// Validation of the message syntax, Lenient by default.
+	Validation Validation
+	// source connection, nil if decoding from a reader
+	c Conn
+	// message source
+	src io.ByteReader
+	// frame head is read
+	started bool
+	// "!" end of data marker is received
+	end bool
+	// ETX is received
+	etx bool
+	// block check character accumulator
+	sum byte
+	// bytes received
+	n int
+	// data lines received
+	lines int
+	// current line buffer
+	buf []byte
+	// offset of the current line in the message
+	lineStart int
+	// line terminator violation of the current line
+	lineErr error
+	// the first parity error of the message
+	parityErr error
+	// final or fatal error
+	err error
+}
+
+// NewDecoder creates a decoder of a data message received from c.
+func NewDecoder(c Conn) *Decoder {
+	d := &Decoder{c: c}
+	if c != nil {
+		d.src = c
+	}
+	return d
+}
+
+// NewReaderDecoder creates a decoder of a data message read from r, e.g. a stored frame.
+// The message must start with the frame head.
+func NewReaderDecoder(r io.Reader) *Decoder {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{src: br}
+}
+
+// BytesRead returns the number of message bytes received so far.
+func (d *Decoder) BytesRead() int {
+	return d.n
+}
+
+// Lines returns the number of data lines received so far.
+func (d *Decoder) Lines() int {
+	return d.lines
+}
+
+// Next reads the next data line.
+// It returns io.EOF after the end of the message if the checksum is valid and ErrBCC otherwise.
+// Parity errors of a connection with software parity are reported as *ParityError at the end of the message.
+// A data line syntax error does not stop decoding, Next can be called again for the following lines.
+// Connection errors and strict validation errors of the message trailer are final.
+func (d *Decoder) Next() (DataLine, error) {
+	var dl DataLine
+	if d.err != nil {
+		return dl, d.err
+	}
+	if !d.started {
+		if err := d.start(); err != nil {
+			d.err = err
+			return dl, err
+		}
+	}
+	line, err := d.readLine()
+	if err != nil {
+		d.err = err
+		return dl, err
+	}
+	if d.Validation == Strict {
+		if i, msg := checkLine(line); i >= 0 {
+			err = d.syntaxError(d.lineStart+i, msg)
+		} else {
+			err = d.lineErr
+		}
+	}
+	d.lines++
+	if err != nil {
+		return dl, err
+	}
+	err = dl.UnmarshalBinary(line)
+	return dl, err
+}
+
+// Decode calls fn for every received data line until the end of the message.
+// If fn returns an error decoding stops and the error is returned.
+// Syntax errors are returned after the whole message is received unless the checksum fails,
+// in which case ErrBCC is returned. fn can be nil to validate the message only.
+func (d *Decoder) Decode(fn func(DataLine) error) error {
+	var first error
+	for {
+		dl, err := d.Next()
+		switch {
+		case err == io.EOF:
+			return first
+		case err == ErrBCC:
+			return err
+		case err != nil && d.err != nil:
+			return err
+		case err != nil:
+			if first == nil {
+				first = err
+			}
+		case fn != nil:
+			if err = fn(dl); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// start prepares the connection and reads the frame head.
+func (d *Decoder) start() error {
+	if d.src == nil {
+		return ErrNoConnection
+	}
+	if d.c != nil {
+		if err := d.c.PrepareRead(); err != nil {
+			return err
+		}
+	}
+	head, err := d.read()
+	if err != nil {
+		return err
+	}
+	d.started = true
+	switch head {
+	case stx:
+		return nil
+	case soh:
+		if d.Validation == Strict {
+			return d.syntaxError(0, "data message must start with STX")
+		}
+		return nil
+	case nak:
+		return ErrNAK
+	}
+	return ErrInvalidFrame
+}
+
+// read reads a byte from the source. Parity errors are saved to be reported at the end of the message.
+func (d *Decoder) read() (byte, error) {
+	b, err := d.src.ReadByte()
+	if _, ok := err.(*ParityError); ok {
+		if d.parityErr == nil {
+			d.parityErr = err
+		}
+		err = nil
+	}
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// readByte reads a message byte and updates the checksum.
+func (d *Decoder) readByte() (byte, error) {
+	b, err := d.read()
+	if err != nil {
+		return 0, err
+	}
+	d.n++
+	d.sum += b
+	return b, nil
+}
+
+// readLine reads the next line without CR LF.
+// It returns io.EOF or ErrBCC when the end of the message is reached.
+func (d *Decoder) readLine() ([]byte, error) {
+	d.buf = d.buf[:0]
+	d.lineStart = d.n + 1
+	d.lineErr = nil
+	for !d.end && !d.etx {
+		b, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case lf:
+			if n := len(d.buf); n > 0 && d.buf[n-1] == cr {
+				d.buf = d.buf[:n-1]
+			} else {
+				d.lineErr = d.syntaxError(d.n, "line feed without carriage return")
+			}
+			return d.buf, nil
+		case end:
+			d.end = true
+		case etx:
+			d.etx = true
+		default:
+			d.buf = append(d.buf, b)
+		}
+	}
+	if n := len(d.buf); n > 0 && d.buf[n-1] == cr {
+		d.buf = d.buf[:n-1]
+	}
+	if len(d.buf) != 0 {
+		// data line is not terminated by CR LF before the end of data
+		d.lineErr = d.syntaxError(d.n, "data line is not terminated by CR LF")
+		return d.buf, nil
+	}
+	return nil, d.trailer()
+}
+
+// trailer reads bytes up to ETX and verifies the block check character.
+// In strict mode anything but CR LF ETX after "!" is a syntax error reported if the checksum is valid.
+func (d *Decoder) trailer() error {
+	var synErr error
+	if !d.end {
+		synErr = d.syntaxError(d.n, "end of data is missing")
+	}
+	want := []byte{cr, lf, etx}
+	for i := 0; !d.etx; i++ {
+		b, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		d.etx = b == etx
+		if synErr == nil && (i >= len(want) || b != want[i]) {
+			synErr = d.syntaxError(d.n, "unexpected character after end of data")
+		}
+	}
+	check, err := d.read()
+	if err != nil {
+		return err
+	}
+	if d.c != nil {
+		d.c.LogResponse()
+	}
+	if d.parityErr != nil {
+		return d.parityErr
+	}
+	if check != d.sum&0x7f {
+		return ErrBCC
+	}
+	if synErr != nil && d.Validation == Strict {
+		return synErr
+	}
+	return io.EOF
+}
+
+// syntaxError returns strict validation error at offset of the message.
+func (d *Decoder) syntaxError(offset int, msg string) error {
+	return &SyntaxError{Offset: offset, Line: d.lines + 1, Msg: msg}
+}
+
+// unexpectedEOF converts end of connection stream to io.ErrUnexpectedEOF
+// to distinguish it from the end of message.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
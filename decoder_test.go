@@ -0,0 +1,221 @@
+package iec62056
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// message returns a connection that receives data message with body.
+func message(body string, check int) Conn {
+	var port serialPort
+	port.rx.WriteByte(stx)
+	port.rx.WriteString(body)
+	if check < 0 {
+		port.rx.WriteByte(bcc([]byte(body)))
+	} else {
+		port.rx.WriteByte(byte(check))
+	}
+	return NewConn(&port, ConnOptions{})
+}
+
+func TestDecoder_Next(t *testing.T) {
+	d := NewDecoder(message("A(1)\r\nB(2)(3)\r\n!\r\n\x03", -1))
+	var got []DataLine
+	for {
+		dl, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, dl)
+		if d.Lines() != len(got) {
+			t.Errorf("Lines() = %v, want %v", d.Lines(), len(got))
+		}
+	}
+	want := []DataLine{
+		{Sets: []DataSet{{Address: "A", Value: "1"}}},
+		{Sets: []DataSet{{Address: "B", Value: "2"}, {Value: "3"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+	if d.BytesRead() != 19 {
+		t.Errorf("BytesRead() = %v", d.BytesRead())
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("Next() after end error = %v", err)
+	}
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name    string
+		conn    Conn
+		fn      func(DataLine) error
+		want    int
+		wantErr error
+	}{
+		{
+			name: "No CRLF before end",
+			conn: message("A(1)\r\nB(2)!\r\n\x03", -1),
+			want: 2,
+		},
+		{
+			name: "ETX without end",
+			conn: message("A(1)\r\n\x03", -1),
+			want: 1,
+		},
+		{
+			name:    "Checksum",
+			conn:    message("A(1)\r\n!\r\n\x03", 0),
+			want:    1,
+			wantErr: ErrBCC,
+		},
+		{
+			name:    "Syntax error is reported at the end",
+			conn:    message("A(1\r\nB(2)\r\n!\r\n\x03", -1),
+			want:    1,
+			wantErr: errors.New("invalid data set"),
+		},
+		{
+			name:    "Callback error",
+			conn:    message("A(1)\r\nB(2)\r\n!\r\n\x03", -1),
+			fn:      func(DataLine) error { return errStop },
+			want:    0,
+			wantErr: errStop,
+		},
+		{
+			name:    "Truncated",
+			conn:    message("A(1)\r\n", -1),
+			want:    1,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "No data",
+			conn:    NewConn(&serialPort{}, ConnOptions{}),
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int
+			fn := tt.fn
+			if fn == nil {
+				fn = func(DataLine) error {
+					got++
+					return nil
+				}
+			}
+			err := NewDecoder(tt.conn).Decode(fn)
+			if (err != nil) != (tt.wantErr != nil) || err != nil && err.Error() != tt.wantErr.Error() {
+				t.Errorf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Decode() lines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder_Strict(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		want    int
+		wantErr error
+	}{
+		{
+			name: "Valid",
+			msg:  "\x02A(1)\r\nB(2*kWh)\r\n!\r\n\x03",
+			want: 2,
+		},
+		{
+			name:    "SOH head",
+			msg:     "\x01A(1)\r\n!\r\n\x03",
+			wantErr: &SyntaxError{Offset: 0, Line: 1, Msg: "data message must start with STX"},
+		},
+		{
+			name:    "Long value",
+			msg:     "\x02A(1)\r\nB(" + strings.Repeat("1", 129) + ")\r\n!\r\n\x03",
+			want:    1,
+			wantErr: &SyntaxError{Offset: 137, Line: 2, Msg: "value longer than 128 characters"},
+		},
+		{
+			name:    "Bare LF",
+			msg:     "\x02A(1)\nB(2)\r\n!\r\n\x03",
+			want:    1,
+			wantErr: &SyntaxError{Offset: 5, Line: 1, Msg: "line feed without carriage return"},
+		},
+		{
+			name:    "No CRLF before end",
+			msg:     "\x02A(1)!\r\n\x03",
+			wantErr: &SyntaxError{Offset: 5, Line: 1, Msg: "data line is not terminated by CR LF"},
+		},
+		{
+			name:    "ETX without end",
+			msg:     "\x02A(1)\r\n\x03",
+			want:    1,
+			wantErr: &SyntaxError{Offset: 7, Line: 2, Msg: "end of data is missing"},
+		},
+		{
+			name:    "Junk after end",
+			msg:     "\x02A(1)\r\n!\r\nXX\x03",
+			want:    1,
+			wantErr: &SyntaxError{Offset: 10, Line: 2, Msg: "unexpected character after end of data"},
+		},
+		{
+			name:    "Checksum takes precedence",
+			msg:     "\x02A(1)\r\n!X\r\n\x03",
+			want:    1,
+			wantErr: ErrBCC,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := []byte(tt.msg)
+			check := bcc(msg[1:])
+			if tt.wantErr == ErrBCC {
+				check++
+			}
+			d := NewReaderDecoder(bytes.NewReader(append(msg, check)))
+			d.Validation = Strict
+			var got int
+			err := d.Decode(func(DataLine) error {
+				got++
+				return nil
+			})
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Decode() lines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder_Parity(t *testing.T) {
+	body := []byte("\x02A(1)\r\nB(2)\r\n!\r\n\x03")
+	msg := withParity(string(append(body, bcc(body[1:]))), EvenParity)
+	msg[8] ^= 0x80
+	var port serialPort
+	port.rx.Write(msg)
+	var got int
+	err := NewDecoder(NewConn(&port, ConnOptions{Parity: EvenParity})).Decode(func(DataLine) error {
+		got++
+		return nil
+	})
+	if !reflect.DeepEqual(err, &ParityError{Offset: 8}) {
+		t.Errorf("Decode() error = %v", err)
+	}
+	if got != 2 {
+		t.Errorf("Decode() lines = %v, want 2", got)
+	}
+}
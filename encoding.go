@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -82,6 +84,27 @@ var commands = map[CommandId][2]byte{
 	CmdB0: {'B', '0'},
 }
 
+// String returns two-character command identifier, e.g. "R1".
+func (c CommandId) String() string {
+	cmd, ok := commands[c]
+	if !ok {
+		return "CommandId(" + strconv.Itoa(int(c)) + ")"
+	}
+	return string(cmd[:])
+}
+
+// ParseCommandId parses case-insensitive two-character command identifier, e.g. "r1".
+func ParseCommandId(s string) (CommandId, error) {
+	if len(s) == 2 {
+		for id, cmd := range commands {
+			if strings.EqualFold(s, string(cmd[:])) {
+				return id, nil
+			}
+		}
+	}
+	return 0, errors.New("invalid command")
+}
+
 var crlf = []byte{cr, lf}
 var breakMsg = []byte{soh, commands[CmdB0][0], commands[CmdB0][1], etx}
 
@@ -105,6 +128,9 @@ type DataSet struct {
 type Command struct {
 	Id      CommandId
 	Payload *DataSet
+	// Manufacturer specific payload sent verbatim instead of Payload.
+	// It is not validated except for frame control characters.
+	Raw []byte
 }
 
 type OptionSelectMessage struct {
@@ -117,13 +143,53 @@ type OptionSelectMessage struct {
 type requestMessage string
 
 type Identity struct {
+	// Identification string without enhanced identification sequences.
 	Device       string
 	Manufacturer string
 	Mode         ProtocolMode
-	bri          byte
+	// Enhanced identification characters W of "\\W" sequences in order of appearance,
+	// e.g. "2" for protocol mode E capability. Other characters are reserved or manufacturer specific.
+	Enhanced string
+	bri      byte
 }
 
+// EnhancedId holds fields of enhanced identification "\\W" sequences.
+// IEC 62056-21 defines W = '2' as protocol mode E capability, other digits are reserved
+// for protocol capabilities and other characters are manufacturer specific.
+// The standard defines no enhanced baud rates, so none are parsed.
+type EnhancedId struct {
+	// Device supports protocol mode E.
+	ModeE bool
+	// Reserved protocol capability digits other than '2' in order of appearance.
+	Capabilities string
+	// Manufacturer specific characters in order of appearance.
+	Extensions string
+}
+
+// IdentityError describes a malformed identification message.
+type IdentityError struct {
+	// Offset of the offending byte in the message.
+	Offset int
+	// Violation description.
+	Msg string
+}
+
+func (e *IdentityError) Error() string {
+	return "invalid identification message: " + e.Msg + " at offset " + strconv.Itoa(e.Offset)
+}
+
+// MarshalBinary encodes data set "Address(Value*Unit)".
+// Fields are validated against protocol character set and length limits, *FieldError is returned on violation.
 func (ds *DataSet) MarshalBinary() ([]byte, error) {
+	if err := checkField("address", ds.Address, maxAddressLen, "()"); err != nil {
+		return nil, err
+	}
+	if err := checkField("value", ds.Value, maxValueLen, "()*"); err != nil {
+		return nil, err
+	}
+	if err := checkField("unit", ds.Unit, maxUnitLen, "()*"); err != nil {
+		return nil, err
+	}
 	length := len(ds.Address)
 	length += len(ds.Value)
 	unitLen := len(ds.Unit)
@@ -176,6 +242,19 @@ func (ds *DataSet) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+// MarshalBinary encodes data sets of the line without line terminator.
+func (dl *DataLine) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	for i := range dl.Sets {
+		data, err := dl.Sets[i].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+	}
+	return b.Bytes(), nil
+}
+
 func (dl *DataLine) UnmarshalBinary(data []byte) error {
 	s := bufio.NewScanner(bytes.NewReader(data))
 	s.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
@@ -201,10 +280,37 @@ func (dl *DataLine) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+// MarshalBinary encodes data message STX DataLine CR LF ... ! CR LF ETX BCC.
+func (db *DataBlock) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte(stx)
+	for i := range db.Lines {
+		data, err := db.Lines[i].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+		b.Write(crlf)
+	}
+	b.WriteByte(end)
+	b.Write(crlf)
+	b.WriteByte(etx)
+	b.WriteByte(bcc(b.Bytes()[1:]))
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary decodes data message. Leading STX and trailing ETX BCC are optional.
+// If both are present then the block check character is verified.
 func (db *DataBlock) UnmarshalBinary(dataIn []byte) error {
 	if len(dataIn) == 0 {
 		return nil
 	}
+	if dataIn[0] == stx {
+		dataIn = dataIn[1:]
+		if i := bytes.IndexByte(dataIn, etx); i >= 0 && i+1 < len(dataIn) && dataIn[i+1] != bcc(dataIn[:i+1]) {
+			return ErrBCC
+		}
+	}
 	i := bytes.IndexByte(dataIn, end)
 	if i == 0 {
 		return nil
@@ -238,10 +344,19 @@ func (db *DataBlock) UnmarshalBinary(dataIn []byte) error {
 func (c *Command) MarshalBinary() ([]byte, error) {
 	var plLen int
 	var pl []byte
-	if c.Payload != nil {
-		pl, _ = c.Payload.MarshalBinary()
-		plLen = len(pl)
+	switch {
+	case c.Raw != nil:
+		if i := bytes.IndexAny(c.Raw, string([]byte{soh, stx, etx})); i >= 0 {
+			return nil, &FieldError{Field: "raw payload", Offset: i, Msg: "frame control character"}
+		}
+		pl = c.Raw
+	case c.Payload != nil:
+		var err error
+		if pl, err = c.Payload.MarshalBinary(); err != nil {
+			return nil, err
+		}
 	}
+	plLen = len(pl)
 	cmd, ok := commands[c.Id]
 	if !ok {
 		return nil, errors.New("invalid command")
@@ -270,19 +385,95 @@ func (address requestMessage) MarshalBinary() ([]byte, error) {
 	return append(msg, end), nil
 }
 
+// MarshalBinary encodes identification message "/XXXZ\\WIdent CR LF".
+// Enhanced identification sequences are written before Device.
+func (id *Identity) MarshalBinary() ([]byte, error) {
+	text, err := id.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]byte, 0, len(text)+3)
+	rv = append(rv, start)
+	rv = append(rv, text...)
+	return append(rv, crlf...), nil
+}
+
+// SetBaudRate sets baud rate identification character of identity's protocol mode.
+func (id *Identity) SetBaudRate(rate int) error {
+	bri, err := encodeBaudRate(id.Mode, rate)
+	if err != nil {
+		return err
+	}
+	id.bri = bri
+	return nil
+}
+
+// UnmarshalBinary decodes identification message "/XXXZ\\WIdent CR LF". Leading "/" and trailing CR LF are optional.
+// Malformed messages are reported as *IdentityError.
 func (id *Identity) UnmarshalBinary(data []byte) error {
+	base := 0
+	if len(data) > 0 && data[0] == start {
+		data = data[1:]
+		base = 1
+	}
+	if bytes.HasSuffix(data, crlf) {
+		data = data[:len(data)-2]
+	}
 	if len(data) < 4 {
-		return errors.New("identity message too short")
+		return &IdentityError{Offset: base + len(data), Msg: "too short"}
+	}
+	for i := 0; i < 3; i++ {
+		if c := data[i] | 0x20; c < 'a' || c > 'z' {
+			return &IdentityError{Offset: base + i, Msg: "manufacturer must be 3 letters"}
+		}
+	}
+	if !isDataChar(data[3]) || data[3] == '\\' {
+		return &IdentityError{Offset: base + 3, Msg: "invalid baud rate character"}
+	}
+	var enhanced []byte
+	i := 4
+	for ; i < len(data) && data[i] == '\\'; i += 2 {
+		if i+1 == len(data) || !isDataChar(data[i+1]) {
+			return &IdentityError{Offset: base + i + 1, Msg: "invalid enhanced identification character"}
+		}
+		enhanced = append(enhanced, data[i+1])
+	}
+	for j := i; j < len(data); j++ {
+		if !isDataChar(data[j]) {
+			return &IdentityError{Offset: base + j, Msg: "invalid identification character"}
+		}
 	}
 	*id = Identity{}
 
 	id.Manufacturer = string(data[0:3])
 	id.bri = data[3]
 	id.Mode = decodeMode(data[3])
-	id.Device = string(data[4 : len(data)-2])
+	id.Enhanced = string(enhanced)
+	id.Device = string(data[i:])
 	return nil
 }
 
+// SupportsModeE reports whether device declares protocol mode E capability with "\\2" sequence.
+func (id Identity) SupportsModeE() bool {
+	return id.EnhancedId().ModeE
+}
+
+// EnhancedId returns fields of enhanced identification sequences.
+func (id Identity) EnhancedId() EnhancedId {
+	var rv EnhancedId
+	for i := 0; i < len(id.Enhanced); i++ {
+		switch c := id.Enhanced[i]; {
+		case c == '2':
+			rv.ModeE = true
+		case '0' <= c && c <= '9':
+			rv.Capabilities += string(c)
+		default:
+			rv.Extensions += string(c)
+		}
+	}
+	return rv
+}
+
 func decodeMode(b byte) ProtocolMode {
 	switch {
 	case '0' <= b && b <= '9':
@@ -293,18 +484,57 @@ func decodeMode(b byte) ProtocolMode {
 	return ModeA
 }
 
-func decodeBaudRate(b byte) int {
-	switch b {
-	case 'A', '1':
-		return 600
-	case 'B', '2':
-		return 1200
-	case 'C', '3':
-		return 2400
-	case 'D', '4':
-		return 4800
-	case 'E', '5':
-		return 9600
-	}
-	return 300
+// baud rates indexed by Mode C baud rate character offset from '0', Mode B offset is one less from 'A'.
+var baudRates = []int{300, 600, 1200, 2400, 4800, 9600, 19200}
+
+// ErrBaudRate is returned for reserved baud rate identification characters.
+var ErrBaudRate = errors.New("unknown baud rate character")
+
+// parseBaudRate returns baud rate of identification character of protocol mode.
+// Mode A always uses 300 baud.
+func parseBaudRate(m ProtocolMode, b byte) (int, error) {
+	switch m {
+	case ModeA:
+		return 300, nil
+	case ModeB:
+		if b >= 'A' && int(b-'A') < len(baudRates)-1 {
+			return baudRates[b-'A'+1], nil
+		}
+	case ModeC, ModeD:
+		if b >= '0' && int(b-'0') < len(baudRates) {
+			return baudRates[b-'0'], nil
+		}
+	}
+	return 0, ErrBaudRate
+}
+
+// encodeBaudRate returns baud rate identification character of the mode.
+// Zero rate selects the lowest rate of the mode.
+func encodeBaudRate(m ProtocolMode, rate int) (byte, error) {
+	var first byte
+	switch m {
+	case ModeA:
+		if rate == 0 || rate == 300 {
+			return 'X', nil
+		}
+		return 0, errors.New("protocol mode A supports 300 baud only")
+	case ModeB:
+		first = 'A' - 1
+		if rate == 0 {
+			rate = 600
+		}
+	case ModeC, ModeD:
+		first = '0'
+		if rate == 0 {
+			rate = 300
+		}
+	default:
+		return 0, errors.New("invalid protocol mode")
+	}
+	for i, r := range baudRates {
+		if r == rate && (i > 0 || m != ModeB) {
+			return first + byte(i), nil
+		}
+	}
+	return 0, errors.New("unsupported baud rate " + strconv.Itoa(rate))
 }
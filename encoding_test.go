@@ -48,6 +48,26 @@ func TestDataSet_MarshalBinary(t *testing.T) {
 			want:    []byte{'A', 'D', 'D', 'R', fb, 'V', 'L', 'L', star, 'U', 'N', rb},
 			wantErr: false,
 		},
+		{
+			name:    "Boundary in value",
+			fields:  fields{Address: "ADDR", Value: "1)2"},
+			wantErr: true,
+		},
+		{
+			name:    "Star in value",
+			fields:  fields{Address: "ADDR", Value: "1*2"},
+			wantErr: true,
+		},
+		{
+			name:    "Non ASCII address",
+			fields:  fields{Address: "ÄDDR"},
+			wantErr: true,
+		},
+		{
+			name:    "Long unit",
+			fields:  fields{Address: "ADDR", Value: "1", Unit: "UUUUUUUUUUUUUUUUU"},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -300,6 +320,7 @@ func TestCommand_MarshalBinary(t *testing.T) {
 	type fields struct {
 		Id      CommandId
 		Payload *DataSet
+		Raw     []byte
 	}
 	tests := []struct {
 		name    string
@@ -324,6 +345,31 @@ func TestCommand_MarshalBinary(t *testing.T) {
 			want:    []byte{soh, 'R', '1', stx, 'A', 'D', 'D', 'R', fb, rb, etx},
 			wantErr: false,
 		},
+		{
+			name: "Invalid Payload",
+			fields: fields{
+				Id:      CmdW1,
+				Payload: &DataSet{Address: "ADDR", Value: "(1)"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Raw Payload",
+			fields: fields{
+				Id:      CmdW1,
+				Payload: &DataSet{Address: "ADDR"},
+				Raw:     []byte("A(1)(2*)"),
+			},
+			want: []byte{soh, 'W', '1', stx, 'A', fb, '1', rb, fb, '2', star, rb, etx},
+		},
+		{
+			name: "Raw Payload with ETX",
+			fields: fields{
+				Id:  CmdW1,
+				Raw: []byte{'A', etx},
+			},
+			wantErr: true,
+		},
 		{
 			name: "Unknown Command",
 			fields: fields{
@@ -338,6 +384,7 @@ func TestCommand_MarshalBinary(t *testing.T) {
 			c := &Command{
 				Id:      tt.fields.Id,
 				Payload: tt.fields.Payload,
+				Raw:     tt.fields.Raw,
 			}
 			got, err := c.MarshalBinary()
 			if (err != nil) != tt.wantErr {
@@ -473,6 +520,25 @@ func TestIdentity_UnmarshalBinary(t *testing.T) {
 			},
 			args:    args{[]byte("iekEtest")},
 			wantErr: false,
+		}, {
+			name:    "Invalid manufacturer",
+			args:    args{[]byte("/i1k5test\r\n")},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid baud rate character",
+			args:    args{[]byte("/iek\x00test\r\n")},
+			wantErr: true,
+		},
+		{
+			name:    "Incomplete enhanced identification",
+			args:    args{[]byte("/iek5\\\r\n")},
+			wantErr: true,
+		},
+		{
+			name:    "Control character in identification",
+			args:    args{[]byte("/iek5te\x01st\r\n")},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
@@ -544,76 +610,260 @@ func Test_decodeMode(t *testing.T) {
 	}
 }
 
-func Test_decodeBaudRate(t *testing.T) {
-	type args struct {
-		b byte
+func TestIdentity_BaudRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      Identity
+		want    int
+		wantErr error
+	}{
+		{"Mode A", Identity{Mode: ModeA, bri: 'X'}, 300, nil},
+		{"Mode B 600", Identity{Mode: ModeB, bri: 'A'}, 600, nil},
+		{"Mode B 19200", Identity{Mode: ModeB, bri: 'F'}, 19200, nil},
+		{"Mode C 600", Identity{Mode: ModeC, bri: '1'}, 600, nil},
+		{"Mode C 9600", Identity{Mode: ModeC, bri: '5'}, 9600, nil},
+		{"Mode C 19200", Identity{Mode: ModeC, bri: '6'}, 19200, nil},
+		{"Reserved", Identity{Mode: ModeC, bri: '7'}, 0, ErrBaudRate},
+		{"Not received", Identity{Mode: ModeC}, 300, nil},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.id.BaudRate()
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("Identity.BaudRate() = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommandId_String(t *testing.T) {
+	tests := []struct {
+		id   CommandId
+		want string
+	}{
+		{CmdR1, "R1"},
+		{CmdB0, "B0"},
+		{CommandId(42), "CommandId(42)"},
+	}
+	for _, tt := range tests {
+		if got := tt.id.String(); got != tt.want {
+			t.Errorf("CommandId.String() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestParseCommandId(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    CommandId
+		wantErr bool
+	}{
+		{"w1", CmdW1, false},
+		{"E2", CmdE2, false},
+		{"x1", 0, true},
+		{"r", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCommandId(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCommandId(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCommandId(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDataBlock_MarshalBinary(t *testing.T) {
 	tests := []struct {
 		name string
-		args args
-		want int
+		db   DataBlock
+		want []byte
 	}{
 		{
-			name: "600",
-			args: args{'A'},
-			want: 600,
+			name: "Empty",
+			db:   DataBlock{},
+			want: []byte{stx, end, cr, lf, etx, 0x3b},
 		},
 		{
-			name: "600",
-			args: args{'1'},
-			want: 600,
-		},
-		{
-			name: "1200",
-			args: args{'B'},
-			want: 1200,
+			name: "Lines",
+			db: DataBlock{Lines: []DataLine{
+				{Sets: []DataSet{{Address: "A", Value: "1", Unit: "kWh"}}},
+				{Sets: []DataSet{{Address: "B", Value: "2"}, {Value: "3"}}},
+			}},
+			want: append([]byte{stx}, []byte("A(1*kWh)\r\nB(2)(3)\r\n!\r\n\x03\x49")...),
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.db.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DataBlock.MarshalBinary() = %q, want %q", got, tt.want)
+			}
+			var db DataBlock
+			if err = db.UnmarshalBinary(got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(db, tt.db) {
+				t.Errorf("DataBlock.UnmarshalBinary() = %v, want %v", db, tt.db)
+			}
+			got[len(got)-1]++
+			if err = db.UnmarshalBinary(got); err != ErrBCC {
+				t.Errorf("DataBlock.UnmarshalBinary() error = %v, want %v", err, ErrBCC)
+			}
+		})
+	}
+}
+
+func TestIdentity_MarshalBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      Identity
+		rate    int
+		want    string
+		wantErr bool
+	}{
 		{
-			name: "1200",
-			args: args{'2'},
-			want: 1200,
+			name: "Mode C",
+			id:   Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC},
+			rate: 9600,
+			want: "/ABC5dev\r\n",
 		},
 		{
-			name: "2400",
-			args: args{'C'},
-			want: 2400,
+			name: "Mode B initial",
+			id:   Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeB},
+			want: "/ABCAdev\r\n",
 		},
 		{
-			name: "2400",
-			args: args{'3'},
-			want: 2400,
+			name: "Enhanced identification",
+			id:   Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, Enhanced: "2"},
+			rate: 300,
+			want: "/ABC0\\2dev\r\n",
 		},
 		{
-			name: "4800",
-			args: args{'D'},
-			want: 4800,
+			name:    "Invalid baud rate",
+			id:      Identity{Manufacturer: "ABC", Mode: ModeC},
+			rate:    14400,
+			wantErr: true,
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rate != 0 {
+				if err := tt.id.SetBaudRate(tt.rate); (err != nil) != tt.wantErr {
+					t.Fatalf("Identity.SetBaudRate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+			}
+			got, err := tt.id.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Identity.MarshalBinary() = %q, want %q", got, tt.want)
+			}
+			var id Identity
+			if err = id.UnmarshalBinary(got); err != nil {
+				t.Fatal(err)
+			}
+			if id.Manufacturer != tt.id.Manufacturer || id.Device != tt.id.Device || id.Mode != tt.id.Mode {
+				t.Errorf("Identity.UnmarshalBinary() = %v, want %v", id, tt.id)
+			}
+			got2, _ := id.MarshalBinary()
+			if !reflect.DeepEqual(got, got2) {
+				t.Errorf("round trip = %q, want %q", got2, got)
+			}
+		})
+	}
+}
+
+func TestIdentity_UnmarshalBinary_Enhanced(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		want         Identity
+		wantEnhanced EnhancedId
+	}{
 		{
-			name: "4800",
-			args: args{'4'},
-			want: 4800,
+			name:         "Mode E",
+			data:         "/ABC5\\2dev\r\n",
+			want:         Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, Enhanced: "2", bri: '5'},
+			wantEnhanced: EnhancedId{ModeE: true},
 		},
 		{
-			name: "9600",
-			args: args{'E'},
-			want: 9600,
+			name:         "Several sequences",
+			data:         "/ABC5\\2\\7\\Xdev\\1\r\n",
+			want:         Identity{Manufacturer: "ABC", Device: "dev\\1", Mode: ModeC, Enhanced: "27X", bri: '5'},
+			wantEnhanced: EnhancedId{ModeE: true, Capabilities: "7", Extensions: "X"},
 		},
 		{
-			name: "9600",
-			args: args{'5'},
-			want: 9600,
+			name:         "Empty identification",
+			data:         "/ABC5\\2\r\n",
+			want:         Identity{Manufacturer: "ABC", Mode: ModeC, Enhanced: "2", bri: '5'},
+			wantEnhanced: EnhancedId{ModeE: true},
 		},
 		{
-			name: "default",
-			args: args{'x'},
-			want: 300,
+			name:         "Without CR LF",
+			data:         "/ABC5\\2",
+			want:         Identity{Manufacturer: "ABC", Mode: ModeC, Enhanced: "2", bri: '5'},
+			wantEnhanced: EnhancedId{ModeE: true},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := decodeBaudRate(tt.args.b); got != tt.want {
-				t.Errorf("decodeBaudRate() = %v, want %v", got, tt.want)
+			var id Identity
+			if err := id.UnmarshalBinary([]byte(tt.data)); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(id, tt.want) {
+				t.Errorf("Identity.UnmarshalBinary() = %+v, want %+v", id, tt.want)
+			}
+			if got := id.EnhancedId(); got != tt.wantEnhanced {
+				t.Errorf("Identity.EnhancedId() = %+v, want %+v", got, tt.wantEnhanced)
+			}
+			if !id.SupportsModeE() {
+				t.Error("Identity.SupportsModeE() = false")
 			}
 		})
 	}
+	err := (&Identity{}).UnmarshalBinary([]byte("/AB\r\n"))
+	if want := (&IdentityError{Offset: 3, Msg: "too short"}); !reflect.DeepEqual(err, want) {
+		t.Errorf("Identity.UnmarshalBinary() error = %v, want %v", err, want)
+	}
+	err = (&Identity{}).UnmarshalBinary([]byte("/ABC5\\\r\n"))
+	want := &IdentityError{Offset: 6, Msg: "invalid enhanced identification character"}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("Identity.UnmarshalBinary() error = %v, want %v", err, want)
+	}
+}
+
+func Test_parseBaudRate(t *testing.T) {
+	tests := []struct {
+		mode    ProtocolMode
+		b       byte
+		want    int
+		wantErr error
+	}{
+		{ModeA, 'X', 300, nil},
+		{ModeB, 'A', 600, nil},
+		{ModeB, 'F', 19200, nil},
+		{ModeB, 'G', 0, ErrBaudRate},
+		{ModeB, '5', 0, ErrBaudRate},
+		{ModeC, '0', 300, nil},
+		{ModeC, '6', 19200, nil},
+		{ModeC, '7', 0, ErrBaudRate},
+		{ModeC, 'E', 0, ErrBaudRate},
+	}
+	for _, tt := range tests {
+		got, err := parseBaudRate(tt.mode, tt.b)
+		if got != tt.want || err != tt.wantErr {
+			t.Errorf("parseBaudRate(%c, %c) = %v, %v, want %v, %v", tt.mode, tt.b, got, err, tt.want, tt.wantErr)
+		}
+	}
 }
@@ -0,0 +1,39 @@
+package iec62056
+
+import "strings"
+
+// manufacturers maps FLAG manufacturer identifiers to names.
+var manufacturers = map[string]string{
+	"ABB": "ABB",
+	"ACE": "Actaris",
+	"ADN": "Aidon",
+	"DZG": "Deutsche Zählergesellschaft",
+	"EBZ": "EBZ",
+	"EFR": "EFR",
+	"ELS": "Elster",
+	"EMH": "EMH metering",
+	"ESY": "EasyMeter",
+	"GAV": "Carlo Gavazzi",
+	"GWF": "GWF MessSysteme",
+	"HAG": "Hager",
+	"HYD": "Hydrometer",
+	"ISK": "Iskraemeco",
+	"ITR": "Itron",
+	"KAM": "Kamstrup",
+	"LGZ": "Landis+Gyr",
+	"NZR": "Nordwestdeutsche Zählerrevision",
+	"SEN": "Sensus",
+	"SIE": "Siemens",
+	"ZPA": "ZPA Smart Energy",
+}
+
+// ManufacturerName returns manufacturer name of FLAG identifier or empty string if it is unknown.
+func (id Identity) ManufacturerName() string {
+	return manufacturers[strings.ToUpper(id.Manufacturer)]
+}
+
+// FastReaction reports whether device claims minimum reaction time of 20 ms
+// that is indicated by lower case third letter of manufacturer identifier.
+func (id Identity) FastReaction() bool {
+	return len(id.Manufacturer) == 3 && id.Manufacturer[2] >= 'a' && id.Manufacturer[2] <= 'z'
+}
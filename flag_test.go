@@ -0,0 +1,26 @@
+package iec62056
+
+import "testing"
+
+func TestIdentity_ManufacturerName(t *testing.T) {
+	tests := []struct {
+		manufacturer string
+		want         string
+		fast         bool
+	}{
+		{"LGZ", "Landis+Gyr", false},
+		{"ISk", "Iskraemeco", true},
+		{"XYZ", "", false},
+		{"xyz", "", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		id := Identity{Manufacturer: tt.manufacturer}
+		if got := id.ManufacturerName(); got != tt.want {
+			t.Errorf("Identity{%q}.ManufacturerName() = %q, want %q", tt.manufacturer, got, tt.want)
+		}
+		if got := id.FastReaction(); got != tt.fast {
+			t.Errorf("Identity{%q}.FastReaction() = %v, want %v", tt.manufacturer, got, tt.fast)
+		}
+	}
+}
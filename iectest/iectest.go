@@ -0,0 +1,285 @@
+// Package iectest provides utilities for testing code built on iec62056.TariffDevice
+// without network connections.
+//
+// Pipe creates an in-memory client connection connected to a scripted meter:
+//
+//	conn, meter := iectest.Pipe()
+//	meter.Expect(iectest.Request("")).Reply(iectest.Identity("ABC5dev"))
+//	meter.Start()
+//	id, err := iec62056.NewTariffDevice(conn).Identity()
+package iectest
+
+import (
+	"bytes"
+	"log"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/srgsf/iec62056.golang"
+)
+
+// DefaultTimeout is a client read timeout used when Line.Timeout is not set.
+const DefaultTimeout = time.Second
+
+// Op is a connection operation that a fault can be injected into.
+type Op int
+
+const (
+	OpPrepareRead Op = iota
+	OpPrepareWrite
+	OpRead
+	OpWrite
+	OpFlush
+	OpSetBaudRate
+	OpClose
+)
+
+// Line contains options of an in-memory connection.
+type Line struct {
+	// Client read timeout. DefaultTimeout is used if zero.
+	Timeout time.Duration
+	// If true then bytes are transferred with even parity bit set as on a 7E1 serial line.
+	// The client uses software parity translation and the meter strips parity bits on reads.
+	Parity bool
+	// Logger for frames received and sent by the client.
+	ProtocolLogger *log.Logger
+}
+
+// Pipe creates connected in-memory client connection and meter with default line options.
+func Pipe() (*Conn, *Meter) {
+	return Line{}.Pipe()
+}
+
+// Pipe creates connected in-memory client connection and meter.
+func (l Line) Pipe() (*Conn, *Meter) {
+	to := l.Timeout
+	if to == 0 {
+		to = DefaultTimeout
+	}
+	toMeter, toClient := newStream(), newStream()
+	c := &Conn{
+		conn: iec62056.NewConn(&endpoint{in: toClient, out: toMeter}, iec62056.ConnOptions{
+			RWTimeOut:      to,
+			ProtocolLogger: l.ProtocolLogger,
+			SwParity:       l.Parity,
+		}),
+		faults: make(map[Op]fault),
+	}
+	m := &Meter{
+		in:     toMeter,
+		out:    toClient,
+		parity: l.Parity,
+		to:     to,
+	}
+	return c, m
+}
+
+// fault is an injected delay and error.
+type fault struct {
+	delay time.Duration
+	err   error
+}
+
+// Conn is an in-memory client connection that implements iec62056.Conn.
+// It tracks baud rate changes and written frames and supports fault injection.
+type Conn struct {
+	// library connection over the in-memory line
+	conn iec62056.Conn
+
+	mu sync.Mutex
+	// one shot faults
+	faults map[Op]fault
+	// baud rate history
+	baudRates []int
+	// flushed frames
+	requests [][]byte
+	// current frame bytes
+	frame bytes.Buffer
+}
+
+var _ iec62056.Conn = (*Conn)(nil)
+
+// Inject makes the next op call sleep for delay and then fail with err.
+// If err is nil the operation proceeds normally after the delay.
+func (c *Conn) Inject(op Op, delay time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults[op] = fault{delay, err}
+}
+
+// fault applies injected fault for op.
+func (c *Conn) fault(op Op) error {
+	c.mu.Lock()
+	f, ok := c.faults[op]
+	delete(c.faults, op)
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	time.Sleep(f.delay)
+	return f.err
+}
+
+// BaudRates returns all baud rates set on the connection in call order.
+func (c *Conn) BaudRates() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int(nil), c.baudRates...)
+}
+
+// BaudRate returns the current baud rate or 0 if it has never been set.
+func (c *Conn) BaudRate() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.baudRates) == 0 {
+		return 0
+	}
+	return c.baudRates[len(c.baudRates)-1]
+}
+
+// Requests returns all frames flushed by the client.
+func (c *Conn) Requests() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.requests...)
+}
+
+func (c *Conn) PrepareWrite() error {
+	if err := c.fault(OpPrepareWrite); err != nil {
+		return err
+	}
+	c.frame.Reset()
+	return c.conn.PrepareWrite()
+}
+
+func (c *Conn) PrepareRead() error {
+	if err := c.fault(OpPrepareRead); err != nil {
+		return err
+	}
+	return c.conn.PrepareRead()
+}
+
+func (c *Conn) LogRequest() {
+	c.conn.LogRequest()
+}
+
+func (c *Conn) LogResponse() {
+	c.conn.LogResponse()
+}
+
+func (c *Conn) ReadByte() (byte, error) {
+	if err := c.fault(OpRead); err != nil {
+		return 0, err
+	}
+	return c.conn.ReadByte()
+}
+
+func (c *Conn) ReadBytes(delim byte) ([]byte, error) {
+	if err := c.fault(OpRead); err != nil {
+		return nil, err
+	}
+	return c.conn.ReadBytes(delim)
+}
+
+func (c *Conn) Write(data []byte) (int, error) {
+	if err := c.fault(OpWrite); err != nil {
+		return 0, err
+	}
+	c.frame.Write(data)
+	return c.conn.Write(data)
+}
+
+func (c *Conn) WriteByte(data byte) error {
+	if err := c.fault(OpWrite); err != nil {
+		return err
+	}
+	c.frame.WriteByte(data)
+	return c.conn.WriteByte(data)
+}
+
+func (c *Conn) Flush() error {
+	if err := c.fault(OpFlush); err != nil {
+		return err
+	}
+	if err := c.conn.Flush(); err != nil {
+		return err
+	}
+	if c.frame.Len() != 0 {
+		c.mu.Lock()
+		c.requests = append(c.requests, append([]byte(nil), c.frame.Bytes()...))
+		c.mu.Unlock()
+		c.frame.Reset()
+	}
+	return nil
+}
+
+func (c *Conn) SetBaudRate(rate int) error {
+	if err := c.fault(OpSetBaudRate); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.baudRates = append(c.baudRates, rate)
+	c.mu.Unlock()
+	return c.conn.SetBaudRate(rate)
+}
+
+// Close closes the connection. The meter reads io.EOF afterwards.
+func (c *Conn) Close() error {
+	if err := c.fault(OpClose); err != nil {
+		return err
+	}
+	return c.conn.Close()
+}
+
+// endpoint is the client end of an in-memory line.
+type endpoint struct {
+	// meter to client stream
+	in *stream
+	// client to meter stream
+	out *stream
+	// read deadline
+	deadline time.Time
+}
+
+func (e *endpoint) Read(p []byte) (int, error) {
+	return e.in.read(p, e.deadline)
+}
+
+func (e *endpoint) Write(p []byte) (int, error) {
+	return e.out.write(p)
+}
+
+func (e *endpoint) Close() error {
+	e.out.close()
+	return nil
+}
+
+func (e *endpoint) SetReadDeadline(t time.Time) error {
+	e.deadline = t
+	return nil
+}
+
+func (e *endpoint) SetWriteDeadline(time.Time) error {
+	// writes never block
+	return nil
+}
+
+// addParity returns a copy of p with even parity bit set.
+func addParity(p []byte) []byte {
+	rv := make([]byte, len(p))
+	for i, b := range p {
+		rv[i] = b & 0x7f
+		if bits.OnesCount8(rv[i])&0x1 == 1 {
+			rv[i] |= 0x80
+		}
+	}
+	return rv
+}
+
+// stripParity clears parity bit in place.
+func stripParity(p []byte) {
+	for i := range p {
+		p[i] &= 0x7f
+	}
+}
@@ -0,0 +1,124 @@
+package iectest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/srgsf/iec62056.golang"
+)
+
+func TestPipe_ReadOut(t *testing.T) {
+	conn, meter := Pipe()
+	meter.Expect(Request("")).Reply(Identity("ABC5dev"))
+	meter.Expect(OptionSelect(iec62056.NormalPCC, '5', iec62056.DataReadOut)).
+		After(10 * time.Millisecond).
+		Reply(DataMessage("1.8.0(001234.5*kWh)\r\n!\r\n"))
+	meter.Start()
+
+	got, err := iec62056.NewTariffDevice(conn).ReadOut()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = meter.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	want := &iec62056.DataBlock{Lines: []iec62056.DataLine{
+		{Sets: []iec62056.DataSet{{Address: "1.8.0", Value: "001234.5", Unit: "kWh"}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadOut() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(conn.BaudRates(), []int{300, 9600}) {
+		t.Errorf("BaudRates() = %v", conn.BaudRates())
+	}
+	if len(conn.Requests()) != 2 {
+		t.Errorf("Requests() = %q", conn.Requests())
+	}
+}
+
+func TestPipe_Parity(t *testing.T) {
+	l := Line{Parity: true}
+	conn, meter := l.Pipe()
+	go func() {
+		buf := make([]byte, 5)
+		_, _ = meter.Read(buf)
+		_, _ = meter.Write(Identity("ABC6dev"))
+	}()
+	if _, err := conn.Write(Request("")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.PrepareRead(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := conn.ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "/ABC6dev\r\n" {
+		t.Errorf("ReadBytes() = %q", got)
+	}
+	if p := addParity([]byte("/?!\r\n")); !reflect.DeepEqual(p, []byte{175, 63, 33, 141, 10}) {
+		t.Errorf("addParity() = %v", p)
+	}
+}
+
+func TestPipe_Faults(t *testing.T) {
+	injected := errors.New("injected")
+	conn, meter := Line{Timeout: 50 * time.Millisecond}.Pipe()
+	meter.Expect(Request("1")).Reply(Identity("ABC6dev"))
+	meter.Start()
+
+	conn.Inject(OpFlush, 0, injected)
+	td := iec62056.WithAddress(conn, "1")
+	if _, err := td.Identity(); !errors.Is(err, injected) {
+		t.Errorf("Identity() error = %v, want %v", err, injected)
+	}
+	conn.Inject(OpRead, 10*time.Millisecond, nil)
+	if _, err := td.Identity(); err != nil {
+		t.Errorf("Identity() error = %v", err)
+	}
+	if err := meter.Wait(); err != nil {
+		t.Error(err)
+	}
+	td.DropProgrammingMode()
+	if _, err := td.Identity(); err == nil {
+		t.Error("Identity() expected timeout")
+	}
+}
+
+func TestMeter_Unexpected(t *testing.T) {
+	conn, meter := Line{Timeout: 50 * time.Millisecond}.Pipe()
+	meter.Expect(Request("2")).Reply(Identity("ABC6dev"))
+	meter.Start()
+	_, _ = iec62056.WithAddress(conn, "1").Identity()
+	if err := meter.Wait(); !errors.Is(err, ErrUnexpectedRequest) {
+		t.Errorf("Wait() error = %v, want %v", err, ErrUnexpectedRequest)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want []byte
+	}{
+		{"Request", Request("12"), []byte("/?12!\r\n")},
+		{"Identity", Identity("ABC5dev"), []byte("/ABC5dev\r\n")},
+		{"Data", DataMessage("A()!\r\n"), []byte{stx, 'A', '(', ')', '!', '\r', '\n', etx, 0x4d}},
+		{"Break", Break(), []byte{0x01, 'B', '0', etx, 0x75}},
+		{"Ack", Ack(), []byte{ack}},
+		{"Nak", Nak(), []byte{nak}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+}
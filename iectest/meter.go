@@ -0,0 +1,217 @@
+package iectest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/srgsf/iec62056.golang"
+)
+
+const (
+	stx = 0x02
+	etx = 0x03
+	ack = 0x06
+	nak = 0x15
+)
+
+// ErrUnexpectedRequest is reported by Meter.Wait when the client sent a frame the script does not expect.
+var ErrUnexpectedRequest = errors.New("unexpected request")
+
+// Step is a single exchange of a meter script.
+type Step struct {
+	// expected request, nil if the step does not wait for a request
+	request []byte
+	// delay before replies
+	delay time.Duration
+	// frames sent in response
+	replies [][]byte
+}
+
+// Reply adds frames sent by the meter after the request is received.
+func (s *Step) Reply(frames ...[]byte) *Step {
+	s.replies = append(s.replies, frames...)
+	return s
+}
+
+// After sets delay between the request reception and the reply.
+func (s *Step) After(d time.Duration) *Step {
+	s.delay = d
+	return s
+}
+
+// Meter is the device end of an in-memory connection that plays a script.
+type Meter struct {
+	// client to meter stream
+	in *stream
+	// meter to client stream
+	out *stream
+	// parity simulation flag
+	parity bool
+	// request wait timeout
+	to time.Duration
+	// script
+	steps []*Step
+	// script result
+	done chan error
+}
+
+// Expect adds a script step that waits for the exact request frame.
+func (m *Meter) Expect(request []byte) *Step {
+	s := &Step{request: request}
+	m.steps = append(m.steps, s)
+	return s
+}
+
+// Send adds a script step that sends frames without waiting for a request.
+func (m *Meter) Send(frames ...[]byte) *Step {
+	s := &Step{}
+	m.steps = append(m.steps, s)
+	return s.Reply(frames...)
+}
+
+// Start plays the script in background.
+func (m *Meter) Start() {
+	m.done = make(chan error, 1)
+	go func() {
+		m.done <- m.play()
+	}()
+}
+
+// Wait waits for the script started with Start to finish and returns the first error.
+func (m *Meter) Wait() error {
+	if m.done == nil {
+		return errors.New("script is not started")
+	}
+	return <-m.done
+}
+
+func (m *Meter) play() error {
+	for i, s := range m.steps {
+		if s.request != nil {
+			got := make([]byte, len(s.request))
+			if err := m.readFull(got); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+			if !bytes.Equal(got, s.request) {
+				return fmt.Errorf("step %d: %w %q, want %q", i, ErrUnexpectedRequest, got, s.request)
+			}
+		}
+		time.Sleep(s.delay)
+		for _, r := range s.replies {
+			if _, err := m.Write(r); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readFull reads exactly len(p) bytes within the line timeout.
+func (m *Meter) readFull(p []byte) error {
+	deadline := time.Now().Add(m.to)
+	for n := 0; n < len(p); {
+		nn, err := m.in.read(p[n:], deadline)
+		if err != nil {
+			return err
+		}
+		n += nn
+	}
+	if m.parity {
+		stripParity(p)
+	}
+	return nil
+}
+
+// Read reads bytes sent by the client. It blocks until data is available or the client closes the connection.
+func (m *Meter) Read(p []byte) (int, error) {
+	n, err := m.in.read(p, time.Time{})
+	if m.parity {
+		stripParity(p[:n])
+	}
+	return n, err
+}
+
+// Write sends bytes to the client applying parity simulation.
+func (m *Meter) Write(p []byte) (int, error) {
+	if m.parity {
+		if _, err := m.out.write(addParity(p)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return m.out.write(p)
+}
+
+// WriteRaw sends bytes to the client as is, e.g. to simulate line errors.
+func (m *Meter) WriteRaw(p []byte) (int, error) {
+	return m.out.write(p)
+}
+
+// Close closes the meter end. The client reads io.EOF once all sent data is read.
+func (m *Meter) Close() error {
+	m.out.close()
+	return nil
+}
+
+var _ io.ReadWriteCloser = (*Meter)(nil)
+
+// Request returns a request message "/?address!CRLF".
+func Request(address string) []byte {
+	return []byte("/?" + address + "!\r\n")
+}
+
+// Identity returns an identification message "/identCRLF", e.g. Identity("ABC5device").
+func Identity(ident string) []byte {
+	return []byte("/" + ident + "\r\n")
+}
+
+// OptionSelect returns an acknowledgement/option select message.
+func OptionSelect(pcc iec62056.PCC, baud byte, o iec62056.Option) []byte {
+	return []byte{ack, byte(pcc), baud, byte(o), '\r', '\n'}
+}
+
+// DataMessage returns a data message STX data ETX BCC, e.g. DataMessage("1.8.0(001234.5*kWh)\r\n!\r\n").
+func DataMessage(data string) []byte {
+	rv := make([]byte, 0, len(data)+3)
+	rv = append(rv, stx)
+	rv = append(rv, data...)
+	rv = append(rv, etx)
+	return append(rv, bcc(rv[1:]))
+}
+
+// Command returns a command message SOH C D STX payload ETX BCC.
+// It panics if the command can not be encoded.
+func Command(cmd iec62056.Command) []byte {
+	rv, err := cmd.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return append(rv, bcc(rv[1:]))
+}
+
+// Ack returns an acknowledgement frame.
+func Ack() []byte {
+	return []byte{ack}
+}
+
+// Nak returns a repeat-request frame.
+func Nak() []byte {
+	return []byte{nak}
+}
+
+// Break returns a break command message.
+func Break() []byte {
+	return Command(iec62056.Command{Id: iec62056.CmdB0})
+}
+
+// bcc calculates block check character.
+func bcc(data []byte) byte {
+	var c byte
+	for _, b := range data {
+		c += b
+	}
+	return c & 0x7f
+}
@@ -0,0 +1,86 @@
+package iectest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// stream is a buffered one-way in-memory byte stream with read deadlines.
+type stream struct {
+	mu sync.Mutex
+	// unread bytes
+	buf bytes.Buffer
+	// closed flag, reads return io.EOF once buffer is drained
+	closed bool
+	// closed and replaced on every write or close
+	notify chan struct{}
+}
+
+func newStream() *stream {
+	return &stream{notify: make(chan struct{})}
+}
+
+// read reads available bytes into p waiting for data until deadline. Zero deadline waits forever.
+func (s *stream) read(p []byte, deadline time.Time) (int, error) {
+	for {
+		s.mu.Lock()
+		if s.buf.Len() > 0 {
+			n, err := s.buf.Read(p)
+			s.mu.Unlock()
+			return n, err
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+		notify := s.notify
+		s.mu.Unlock()
+
+		if deadline.IsZero() {
+			<-notify
+			continue
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-notify:
+			t.Stop()
+		case <-t.C:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// write appends p to the stream.
+func (s *stream) write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, io.ErrClosedPipe
+	}
+	n, _ := s.buf.Write(p)
+	s.wake()
+	return n, nil
+}
+
+// close closes the stream.
+func (s *stream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.wake()
+	}
+}
+
+// wake notifies waiting readers. Must be called with mu held.
+func (s *stream) wake() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
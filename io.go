@@ -3,6 +3,8 @@ package iec62056
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -16,6 +18,55 @@ import (
 // default i/o frame operations timeout
 const timeout = time.Second * 5
 
+// default frame size limits
+const (
+	defaultMaxIdentitySize = 128
+	defaultMaxFrameSize    = 256 * 1024
+)
+
+// ErrEchoMismatch is returned by Flush when echo of transmitted bytes differs from the sent frame,
+// e.g. because of bus contention.
+var ErrEchoMismatch = errors.New("echo mismatch")
+
+// Parity selects software parity translation of a 7 bit serial line carried over 8 bit transport.
+type Parity int
+
+const (
+	// NoParity passes bytes unchanged.
+	NoParity Parity = iota
+	// EvenParity sets parity bit on writes and verifies it on reads (7E1).
+	EvenParity
+	// OddParity sets parity bit on writes and verifies it on reads (7O1).
+	OddParity
+)
+
+// ParityError is returned when a received byte fails parity check.
+// Reading is not interrupted by the error, the byte is returned with parity bit cleared.
+type ParityError struct {
+	// Byte offset in the frame.
+	Offset int
+}
+
+func (e *ParityError) Error() string {
+	return "parity error at offset " + strconv.Itoa(e.Offset)
+}
+
+// FrameSizeError is returned when a received frame exceeds its size limit.
+type FrameSizeError struct {
+	// Size limit in bytes.
+	Limit int
+	// True if the limit of identification message is exceeded.
+	Identity bool
+}
+
+func (e *FrameSizeError) Error() string {
+	frame := "frame"
+	if e.Identity {
+		frame = "identification message"
+	}
+	return frame + " exceeds " + strconv.Itoa(e.Limit) + " bytes"
+}
+
 type Conn interface {
 	// PrepareWrite configures frame writing operation. Call it once before frame sequential writes.
 	PrepareWrite() error
@@ -41,10 +92,10 @@ type Conn interface {
 	Close() error
 }
 
-// tcpConn is a network connection handle
-type tcpConn struct {
-	// wrapped connection
-	rwc net.Conn
+// conn is a connection handle over an arbitrary transport.
+type conn struct {
+	// wrapped transport
+	rwc io.ReadWriteCloser
 	// operations wrapper
 	io io.ReadWriter
 	// i/o operations timeout
@@ -55,59 +106,139 @@ type tcpConn struct {
 	w writer
 }
 
-func (c *tcpConn) Close() error {
+// transport that supports read deadlines, e.g. net.Conn.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// transport that supports write deadlines, e.g. net.Conn.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// transport that is able to change its baud rate, e.g. serial port.
+type baudRateSetter interface {
+	SetBaudRate(int) error
+}
+
+func (c *conn) Close() error {
 	return c.rwc.Close()
 }
 
-func (c *tcpConn) PrepareRead() error {
+func (c *conn) PrepareRead() error {
 	c.r.reset(c.io)
-	if err := c.rwc.SetReadDeadline(time.Now().Add(c.to)); err != nil {
-		return err
+	if d, ok := c.rwc.(readDeadliner); ok {
+		if err := d.SetReadDeadline(time.Now().Add(c.to)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (c *tcpConn) PrepareWrite() error {
+func (c *conn) PrepareWrite() error {
 	c.w.reset(c.io)
-	if err := c.rwc.SetWriteDeadline(time.Now().Add(c.to)); err != nil {
-		return err
+	if d, ok := c.rwc.(writeDeadliner); ok {
+		if err := d.SetWriteDeadline(time.Now().Add(c.to)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (c *tcpConn) LogResponse() {
+func (c *conn) LogResponse() {
 	c.r.log("response")
 }
 
-func (c *tcpConn) LogRequest() {
+func (c *conn) LogRequest() {
 	c.w.log("request")
 }
 
-func (c *tcpConn) ReadByte() (byte, error) {
+func (c *conn) ReadByte() (byte, error) {
 	return c.r.ReadByte()
 }
 
-func (c *tcpConn) ReadBytes(delim byte) ([]byte, error) {
+// Read reads raw bytes, e.g. of a secondary protocol. Parity bits are stripped without verification.
+func (c *conn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *conn) ReadBytes(delim byte) ([]byte, error) {
 	return c.r.ReadBytes(delim)
 }
 
-func (c *tcpConn) Write(data []byte) (int, error) {
+func (c *conn) Write(data []byte) (int, error) {
 	return c.w.Write(data)
 }
 
-func (c *tcpConn) WriteByte(data byte) error {
+func (c *conn) WriteByte(data byte) error {
 	return c.w.WriteByte(data)
 }
 
-func (c *tcpConn) Flush() error {
-	return c.w.Flush()
+// Flush writes buffered frame. If echo cancellation is enabled then the echo of the frame is read back and verified.
+func (c *conn) Flush() error {
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	if !c.w.echo {
+		return nil
+	}
+	sent := c.w.sent
+	c.w.sent = c.w.sent[:0]
+	if d, ok := c.rwc.(readDeadliner); ok {
+		if err := d.SetReadDeadline(time.Now().Add(c.to)); err != nil {
+			return err
+		}
+	}
+	for _, want := range sent {
+		b, err := c.r.Reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c.r.parity != NoParity {
+			b &= 0x7f
+		}
+		if b != want {
+			return ErrEchoMismatch
+		}
+	}
+	return nil
 }
 
-func (c *tcpConn) SetBaudRate(int) error {
+func (c *conn) SetBaudRate(rate int) error {
+	if s, ok := c.rwc.(baudRateSetter); ok {
+		return s.SetBaudRate(rate)
+	}
 	//nothing to do for tcp connection
 	return nil
 }
 
+// ConnOptions contains options for a connection over an arbitrary transport.
+type ConnOptions struct {
+	// I/O frame operations timeout. Applied only if the transport supports deadlines.
+	RWTimeOut time.Duration
+	// Logger for received and sent frames.
+	ProtocolLogger *log.Logger
+	// If true then even partiy translation is applied on reads and writes.
+	// It is equivalent to EvenParity and ignored if Parity is set.
+	SwParity bool
+	// Software parity translation applied on reads and writes.
+	Parity Parity
+	// Maximum size in bytes of a received data or command frame. Zero means 256 KiB.
+	MaxFrameSize int
+	// Maximum size in bytes of a received identification message. Zero means 128.
+	MaxIdentitySize int
+	// If true then transmitted bytes echoed by half-duplex or optical interface are read back
+	// and verified on Flush.
+	Echo bool
+}
+
+// NewConn creates a connection over any transport, e.g. TLS session, ssh channel or serial port.
+// If rwc has SetReadDeadline and SetWriteDeadline methods then RWTimeOut is applied to frame operations.
+// If rwc has SetBaudRate(int) error method then baud rate changes are passed to it.
+func NewConn(rwc io.ReadWriteCloser, o ConnOptions) Conn {
+	return newConn(rwc, o)
+}
+
 // A TCPDialer contains options for connecting to a network.
 type TCPDialer struct {
 	// Tcp socket connection timeout.
@@ -117,7 +248,19 @@ type TCPDialer struct {
 	// Logger for received and sent frames.
 	ProtocolLogger *log.Logger
 	// If true then even partiy translation is applied on reads and writes.
+	// It is equivalent to EvenParity and ignored if Parity is set.
 	SwParity bool
+	// Software parity translation applied on reads and writes.
+	Parity Parity
+	// Optional dial function for custom transports, e.g. (*tls.Dialer).DialContext,
+	// ssh forwarding or unix sockets. It is called with "tcp" network. If nil then net.Dialer is used.
+	DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+	// Maximum size in bytes of a received data or command frame. Zero means 256 KiB.
+	MaxFrameSize int
+	// Maximum size in bytes of a received identification message. Zero means 128.
+	MaxIdentitySize int
+	// If true then transmitted bytes echoed by the interface are read back and verified on Flush.
+	Echo bool
 }
 
 // DialTCP connects to the tcp socket on the named network.
@@ -130,69 +273,114 @@ func DialTCP(socket string) (Conn, error) {
 // Dial connects to the tcp socket on the named network.
 // The socket has the form "host:port".
 func (d *TCPDialer) Dial(socket string) (Conn, error) {
-	conn, err := net.DialTimeout("tcp", socket, d.ConnectionTimeOut)
+	return d.DialContext(context.Background(), socket)
+}
+
+// DialContext connects to the tcp socket on the named network using the provided context.
+// The socket has the form "host:port".
+func (d *TCPDialer) DialContext(ctx context.Context, socket string) (Conn, error) {
+	if d.ConnectionTimeOut != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.ConnectionTimeOut)
+		defer cancel()
+	}
+	dial := d.DialFunc
+	if dial == nil {
+		var nd net.Dialer
+		dial = nd.DialContext
+	}
+	c, err := dial(ctx, "tcp", socket)
 	if err != nil {
 		return nil, err
 	}
 
-	var to = d.RWTimeOut
-	if to == 0 {
-		to = timeout
-	}
-	return newConn(conn, d.ProtocolLogger, d.SwParity, to), nil
+	return NewConn(c, ConnOptions{
+		RWTimeOut:       d.RWTimeOut,
+		ProtocolLogger:  d.ProtocolLogger,
+		SwParity:        d.SwParity,
+		Parity:          d.Parity,
+		MaxFrameSize:    d.MaxFrameSize,
+		MaxIdentitySize: d.MaxIdentitySize,
+		Echo:            d.Echo,
+	}), nil
 }
 
 // creates connection.
-func newConn(conn net.Conn, log *log.Logger, swParity bool, to time.Duration) *tcpConn {
+func newConn(rwc io.ReadWriteCloser, o ConnOptions) *conn {
 	var l = &logger{
-		l: log,
+		l: o.ProtocolLogger,
+	}
+	parity := o.Parity
+	if parity == NoParity && o.SwParity {
+		parity = EvenParity
+	}
+	var io io.ReadWriter = rwc
+	if parity != NoParity {
+		io = &parityWrapper{io: rwc, parity: parity}
+	}
+	to := o.RWTimeOut
+	if to == 0 {
+		to = timeout
+	}
+	r := reader{
+		logger:      l,
+		Reader:      bufio.NewReader(io),
+		maxFrame:    o.MaxFrameSize,
+		maxIdentity: o.MaxIdentitySize,
+		parity:      parity,
+	}
+	if r.maxFrame == 0 {
+		r.maxFrame = defaultMaxFrameSize
 	}
-	var io io.ReadWriter = conn
-	if swParity {
-		io = &parityWrapper{io: conn}
+	if r.maxIdentity == 0 {
+		r.maxIdentity = defaultMaxIdentitySize
 	}
 
-	return &tcpConn{
-		conn,
+	return &conn{
+		rwc,
 		io,
 		to,
-		reader{
-			l,
-			bufio.NewReader(io),
-		},
+		r,
 		writer{
-			l,
-			bufio.NewWriter(io),
+			logger: l,
+			Writer: bufio.NewWriter(io),
+			echo:   o.Echo,
 		},
 	}
 }
 
+// parityWrapper sets parity bit on writes. Received bytes are verified and stripped by reader.
 type parityWrapper struct {
-	io io.ReadWriter
+	io     io.ReadWriter
+	parity Parity
 }
 
 func (w *parityWrapper) Read(p []byte) (int, error) {
-	n, err := w.io.Read(p)
-	if err != nil {
-		return n, err
-	}
-	for i := 0; i < n; i++ {
-		p[i] &= 0x7f
-	}
-	return n, err
+	return w.io.Read(p)
 }
 
 func (w *parityWrapper) Write(p []byte) (int, error) {
 	p2 := make([]byte, len(p))
 	copy(p2, p)
 	for i, b := range p2 {
-		if bits.OnesCount8(b)&0x1 == 1 {
+		if !checkParity(b, w.parity) {
 			p2[i] |= 0x80
 		}
 	}
 	return w.io.Write(p2)
 }
 
+// checkParity reports whether b has valid parity bit.
+func checkParity(b byte, p Parity) bool {
+	switch p {
+	case EvenParity:
+		return bits.OnesCount8(b)&0x1 == 0
+	case OddParity:
+		return bits.OnesCount8(b)&0x1 == 1
+	}
+	return true
+}
+
 // Frame logger
 type logger struct {
 	// buffer for partial reads writes.
@@ -209,59 +397,135 @@ func (l *logger) log(prefix string) {
 	l.buf.Reset()
 }
 
-// Buffered reader that logs read bytes.
+// Buffered reader that logs read bytes and limits frame size.
 type reader struct {
 	*logger
 	*bufio.Reader
-}
-
-// reset resets collected frame's log message.
+	// data frame size limit
+	maxFrame int
+	// identification message size limit
+	maxIdentity int
+	// bytes read of the current frame
+	n int
+	// current frame size limit, 0 until frame head is read
+	limit int
+	// current frame is identification message
+	identity bool
+	// software parity to verify and strip
+	parity Parity
+}
+
+// reset resets collected frame's log message and frame size counter.
 func (b *reader) reset(r io.Reader) {
 	b.logger.buf.Reset()
+	b.n, b.limit = 0, 0
+}
+
+// count accounts a read byte against the frame size limit.
+// The limit is selected by frame head, a new frame starts after identification message line feed.
+func (b *reader) count(c byte) error {
+	if b.limit == 0 {
+		b.identity = c == start
+		b.limit = b.maxFrame
+		if b.identity {
+			b.limit = b.maxIdentity
+		}
+	}
+	b.n++
+	if b.n > b.limit {
+		return &FrameSizeError{Limit: b.limit, Identity: b.identity}
+	}
+	if c == lf && b.identity {
+		b.n, b.limit = 0, 0
+	}
+	return nil
 }
 
 // io.Reader interface implementation.
-// Read reads data into p and appends it to frame's log message.
+// Read reads data into p and appends it to frame's log message. Parity bits are stripped without verification.
 func (b *reader) Read(p []byte) (int, error) {
 	n, err := b.Reader.Read(p)
+	if b.parity != NoParity {
+		for i := 0; i < n; i++ {
+			p[i] &= 0x7f
+		}
+	}
 	if err == nil && b.l != nil {
-		_, err = b.logger.buf.Write(p)
+		_, err = b.logger.buf.Write(p[:n])
 	}
 	return n, err
 }
 
 // bufio.Reader interface implementation.
+// If software parity is enabled then the byte is returned with *ParityError if parity check fails.
 func (b *reader) ReadByte() (byte, error) {
 	n, err := b.Reader.ReadByte()
-	if err == nil && b.l != nil {
+	if err != nil {
+		return n, err
+	}
+	valid := checkParity(n, b.parity)
+	if b.parity != NoParity {
+		n &= 0x7f
+	}
+	offset := b.n
+	if err = b.count(n); err != nil {
+		return 0, err
+	}
+	if b.l != nil {
 		_ = b.logger.buf.WriteByte(n)
 	}
-	return n, err
+	if !valid {
+		return n, &ParityError{Offset: offset}
+	}
+	return n, nil
 }
 
 // bufio.Reader interface implementation.
+// Reading stops with *FrameSizeError if the frame size limit is exceeded before delim.
+// Parity errors do not stop reading, the first one is returned with data.
 func (b *reader) ReadBytes(delim byte) ([]byte, error) {
-	data, err := b.Reader.ReadBytes(delim)
-	if err == nil && b.l != nil {
-		_, err = b.logger.buf.Write(data)
+	var data []byte
+	var parityErr error
+	for {
+		c, err := b.ReadByte()
+		if _, ok := err.(*ParityError); ok {
+			if parityErr == nil {
+				parityErr = err
+			}
+			err = nil
+		}
+		if err != nil {
+			return data, err
+		}
+		data = append(data, c)
+		if c == delim {
+			return data, parityErr
+		}
 	}
-	return data, err
 }
 
 // Buffered writer that logs written bytes
 type writer struct {
 	*logger
 	*bufio.Writer
+	// echo cancellation flag
+	echo bool
+	// bytes written since the last flush, kept for echo verification
+	sent []byte
 }
 
 // reset resets collected frame's log message.
 func (b *writer) reset(w io.Writer) {
 	b.logger.buf.Reset()
+	b.sent = b.sent[:0]
 }
 
 // io.Writer implementation.
 func (b *writer) Write(p []byte) (int, error) {
 	nn, err := b.Writer.Write(p)
+	if b.echo {
+		b.sent = append(b.sent, p[:nn]...)
+	}
 	if err == nil && b.l != nil {
 		_, err = b.logger.buf.Write(p)
 	}
@@ -271,6 +535,9 @@ func (b *writer) Write(p []byte) (int, error) {
 // bufio.Writer implementation.
 func (b *writer) WriteByte(p byte) error {
 	err := b.Writer.WriteByte(p)
+	if err == nil && b.echo {
+		b.sent = append(b.sent, p)
+	}
 	if err == nil && b.l != nil {
 		_ = b.logger.buf.WriteByte(p)
 	}
@@ -1,8 +1,13 @@
 package iec62056
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -28,7 +33,9 @@ func Test_FixParity(t *testing.T) {
 		_, _ = server.Read(buf)
 		resp := []byte("/ABC6dev\r\n")
 		for i := 0; i < len(resp); i++ {
-			resp[i] |= 0x80
+			if !checkParity(resp[i], EvenParity) {
+				resp[i] |= 0x80
+			}
 		}
 		_, _ = server.Write(resp)
 		if !reflect.DeepEqual(buf[:5], []byte{175, 63, 33, 141, 10}) {
@@ -51,3 +58,263 @@ func Test_FixParity(t *testing.T) {
 	}
 
 }
+
+// in-memory transport without deadlines that tracks baud rate.
+type serialPort struct {
+	rx       bytes.Buffer
+	tx       bytes.Buffer
+	baudRate int
+}
+
+func (s *serialPort) Read(p []byte) (int, error) {
+	return s.rx.Read(p)
+}
+
+func (s *serialPort) Write(p []byte) (int, error) {
+	return s.tx.Write(p)
+}
+
+func (s *serialPort) Close() error {
+	return nil
+}
+
+func (s *serialPort) SetBaudRate(rate int) error {
+	s.baudRate = rate
+	return nil
+}
+
+func TestNewConn(t *testing.T) {
+	var port serialPort
+	port.rx.WriteString("/iek6test\r\n")
+	conn := NewConn(&port, ConnOptions{})
+	res, err := NewTariffDevice(conn).Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Device != "test" {
+		t.Errorf("Identity() = %v", res)
+	}
+	if port.baudRate != 300 {
+		t.Errorf("baud rate is not passed to transport, got %v", port.baudRate)
+	}
+	if port.tx.String() != "/?!\r\n" {
+		t.Errorf("request = %q", port.tx.String())
+	}
+}
+
+func TestTCPDialer_DialFunc(t *testing.T) {
+	var called bool
+	d := &TCPDialer{
+		DialFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			called = true
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+	}
+	go func() {
+		rv, _ := listener.Accept()
+		ch <- rv
+	}()
+	conn, err := d.Dial(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-ch
+	server.Close()
+	conn.Close()
+	if !called {
+		t.Error("DialFunc is not used")
+	}
+
+	d.DialFunc = func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("refused")
+	}
+	if _, err = d.Dial("localhost:0"); err == nil {
+		t.Error("DialFunc error is not returned")
+	}
+}
+
+func TestConn_MaxFrameSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		rx      string
+		delim   []byte
+		wantErr error
+	}{
+		{
+			name:  "Within limits",
+			rx:    "/ABC5dev\r\n\x02A(1)\x03",
+			delim: []byte{lf, etx},
+		},
+		{
+			name:    "Identity without line feed",
+			rx:      "/ABC5" + strings.Repeat("x", 20),
+			delim:   []byte{lf},
+			wantErr: &FrameSizeError{Limit: 16, Identity: true},
+		},
+		{
+			name:    "Data without ETX",
+			rx:      "\x02" + strings.Repeat("A(1)", 10),
+			delim:   []byte{etx},
+			wantErr: &FrameSizeError{Limit: 32},
+		},
+		{
+			name:    "Data after identity",
+			rx:      "/ABC5dev\r\n\x02" + strings.Repeat("A(1)", 10),
+			delim:   []byte{lf, etx},
+			wantErr: &FrameSizeError{Limit: 32},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.WriteString(tt.rx)
+			c := NewConn(&port, ConnOptions{MaxFrameSize: 32, MaxIdentitySize: 16})
+			if err := c.PrepareRead(); err != nil {
+				t.Fatal(err)
+			}
+			var err error
+			for _, d := range tt.delim {
+				if _, err = c.ReadBytes(d); err != nil {
+					break
+				}
+			}
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("ReadBytes() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFrameSizeError_Error(t *testing.T) {
+	err := &FrameSizeError{Limit: 128, Identity: true}
+	if err.Error() != "identification message exceeds 128 bytes" {
+		t.Errorf("FrameSizeError.Error() = %v", err)
+	}
+}
+
+// withParity returns s with parity bits set.
+func withParity(s string, p Parity) []byte {
+	rv := []byte(s)
+	for i, b := range rv {
+		if !checkParity(b, p) {
+			rv[i] |= 0x80
+		}
+	}
+	return rv
+}
+
+func TestConn_Parity(t *testing.T) {
+	tests := []struct {
+		name    string
+		o       ConnOptions
+		rx      []byte
+		wantTx  []byte
+		wantErr error
+	}{
+		{
+			name:   "Even",
+			o:      ConnOptions{Parity: EvenParity},
+			rx:     withParity("/ABC5dev\r\n", EvenParity),
+			wantTx: withParity("/?!", EvenParity),
+		},
+		{
+			name:   "Software parity flag",
+			o:      ConnOptions{SwParity: true},
+			rx:     withParity("/ABC5dev\r\n", EvenParity),
+			wantTx: withParity("/?!", EvenParity),
+		},
+		{
+			name:   "Odd",
+			o:      ConnOptions{Parity: OddParity},
+			rx:     withParity("/ABC5dev\r\n", OddParity),
+			wantTx: withParity("/?!", OddParity),
+		},
+		{
+			name:    "Even check fails",
+			o:       ConnOptions{Parity: EvenParity},
+			rx:      withParity("/ABC5dev\r\n", OddParity),
+			wantTx:  withParity("/?!", EvenParity),
+			wantErr: &ParityError{Offset: 0},
+		},
+		{
+			name:   "No parity",
+			rx:     []byte("/ABC5dev\r\n"),
+			wantTx: []byte("/?!"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.Write(tt.rx)
+			c := NewConn(&port, tt.o)
+			_ = c.PrepareWrite()
+			_, _ = c.Write([]byte("/?!"))
+			_ = c.Flush()
+			if !bytes.Equal(port.tx.Bytes(), tt.wantTx) {
+				t.Errorf("Write() = %v, want %v", port.tx.Bytes(), tt.wantTx)
+			}
+			_ = c.PrepareRead()
+			data, err := c.ReadBytes(lf)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("ReadBytes() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(data) != "/ABC5dev\r\n" {
+				t.Errorf("ReadBytes() = %q", data)
+			}
+		})
+	}
+}
+
+func TestConn_Echo(t *testing.T) {
+	tests := []struct {
+		name    string
+		o       ConnOptions
+		rx      []byte
+		wantErr error
+	}{
+		{
+			name: "Echo",
+			o:    ConnOptions{Echo: true},
+			rx:   []byte("/?!\r\n/ABC5dev\r\n"),
+		},
+		{
+			name: "Echo with parity",
+			o:    ConnOptions{Echo: true, Parity: EvenParity},
+			rx:   withParity("/?!\r\n/ABC5dev\r\n", EvenParity),
+		},
+		{
+			name:    "Mismatch",
+			o:       ConnOptions{Echo: true},
+			rx:      []byte("/?\x00\r\n/ABC5dev\r\n"),
+			wantErr: ErrEchoMismatch,
+		},
+		{
+			name:    "No echo",
+			o:       ConnOptions{Echo: true},
+			rx:      []byte("/?"),
+			wantErr: io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.Write(tt.rx)
+			c := NewConn(&port, tt.o)
+			_ = c.PrepareWrite()
+			_, _ = c.Write([]byte("/?!"))
+			_, _ = c.Write(crlf)
+			if err := c.Flush(); err != tt.wantErr {
+				t.Fatalf("Flush() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			_ = c.PrepareRead()
+			data, err := c.ReadBytes(lf)
+			if err != nil || string(data) != "/ABC5dev\r\n" {
+				t.Errorf("ReadBytes() = %q, %v", data, err)
+			}
+		})
+	}
+}
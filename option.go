@@ -0,0 +1,47 @@
+package iec62056
+
+import (
+	"strings"
+	"sync"
+)
+
+// OptionHandler performs manufacturer specific exchange after option select message is sent
+// and the connection is switched to the selected baud rate.
+// id is the identity of the device. Lines of the returned data block are passed to the caller of TariffDevice.Option.
+// The block can be nil if the reply is not a data message, TariffDevice.Option then returns an empty data block.
+type OptionHandler func(c Conn, id Identity) (*DataBlock, error)
+
+// option handlers keyed by upper case manufacturer and option.
+var optionHandlers = struct {
+	sync.RWMutex
+	m map[optionKey]OptionHandler
+}{m: make(map[optionKey]OptionHandler)}
+
+type optionKey struct {
+	manufacturer string
+	option       Option
+}
+
+// RegisterOptionHandler registers handler of option for devices of manufacturer, e.g. "ABC".
+// Manufacturer is matched case-insensitively, so the lower case third letter of fast devices does not matter.
+// A nil handler removes the registration. Only Option6..Option9 can be registered, it panics otherwise.
+func RegisterOptionHandler(manufacturer string, o Option, h OptionHandler) {
+	if o < Option6 || o > Option9 {
+		panic("iec62056: option " + string(rune(o)) + " is not manufacturer specific")
+	}
+	k := optionKey{strings.ToUpper(manufacturer), o}
+	optionHandlers.Lock()
+	defer optionHandlers.Unlock()
+	if h == nil {
+		delete(optionHandlers.m, k)
+		return
+	}
+	optionHandlers.m[k] = h
+}
+
+// lookupOptionHandler returns handler registered for manufacturer and option or nil.
+func lookupOptionHandler(manufacturer string, o Option) OptionHandler {
+	optionHandlers.RLock()
+	defer optionHandlers.RUnlock()
+	return optionHandlers.m[optionKey{strings.ToUpper(manufacturer), o}]
+}
@@ -0,0 +1,100 @@
+package iec62056
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRegisterOptionHandler(t *testing.T) {
+	var gotId Identity
+	h := func(c Conn, id Identity) (*DataBlock, error) {
+		gotId = id
+		if err := c.PrepareRead(); err != nil {
+			return nil, err
+		}
+		// proprietary reply: length prefixed binary block
+		n, err := c.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, n)
+		for i := range data {
+			if data[i], err = c.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+		return &DataBlock{Lines: []DataLine{{Sets: []DataSet{{Address: "bin", Value: string(data)}}}}}, nil
+	}
+	RegisterOptionHandler("abc", Option7, h)
+	body := []byte("A(1)\r\n!\r\n\x03")
+	readout := append(append([]byte{stx}, body...), bcc(body))
+	defer RegisterOptionHandler("ABC", Option7, nil)
+	RegisterOptionHandler("ABC", Option9, func(Conn, Identity) (*DataBlock, error) { return nil, nil })
+	defer RegisterOptionHandler("ABC", Option9, nil)
+
+	tests := []struct {
+		name   string
+		ident  string
+		option Option
+		rx     []byte
+		want   *DataBlock
+	}{
+		{
+			name:   "Registered",
+			ident:  "/ABc5dev\r\n",
+			option: Option7,
+			rx:     []byte{2, 'h', 'i'},
+			want:   &DataBlock{Lines: []DataLine{{Sets: []DataSet{{Address: "bin", Value: "hi"}}}}},
+		},
+		{
+			name:   "Nil data block",
+			ident:  "/ABC5dev\r\n",
+			option: Option9,
+			want:   &DataBlock{},
+		},
+		{
+			name:   "Other manufacturer",
+			ident:  "/XYZ5dev\r\n",
+			option: Option7,
+			rx:     readout,
+			want:   &DataBlock{Lines: []DataLine{{Sets: []DataSet{{Address: "A", Value: "1"}}}}},
+		},
+		{
+			name:   "Other option",
+			ident:  "/ABC5dev\r\n",
+			option: Option8,
+			rx:     readout,
+			want:   &DataBlock{Lines: []DataLine{{Sets: []DataSet{{Address: "A", Value: "1"}}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.WriteString(tt.ident)
+			port.rx.Write(tt.rx)
+			got, err := NewTariffDevice(NewConn(&port, ConnOptions{})).Option(OptionSelectMessage{Option: tt.option, PCC: NormalPCC})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Option() = %v, want %v", got, tt.want)
+			}
+			if !bytes.HasSuffix(port.tx.Bytes(), []byte{ack, '0', '5', byte(tt.option), cr, lf}) {
+				t.Errorf("sent %q", port.tx.Bytes())
+			}
+		})
+	}
+	if gotId.Manufacturer != "ABc" {
+		t.Errorf("handler identity = %v", gotId)
+	}
+}
+
+func TestRegisterOptionHandler_panics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterOptionHandler() expected panic for programming mode option")
+		}
+	}()
+	RegisterOptionHandler("ABC", ProgrammingMode, func(Conn, Identity) (*DataBlock, error) { return nil, nil })
+}
@@ -0,0 +1,83 @@
+package iec62056
+
+import (
+	"context"
+	"errors"
+)
+
+// PasswordRequest describes the device asking for a password.
+type PasswordRequest struct {
+	// Device address used in request message, empty for broadcast.
+	Address string
+	// Identity of the device.
+	Identity Identity
+	// Operand sent by device with P0 command, used by encoded passwords.
+	Operand DataSet
+	// Requested access level, zero if any password is acceptable.
+	Level int
+}
+
+// Password is a reply to password request.
+type Password struct {
+	// CmdP1 for clear text passwords, CmdP2 for passwords encoded using operand.
+	Command CommandId
+	// Password data set sent to device.
+	Value DataSet
+	// Level of the password on devices with several passwords, e.g. 1..3.
+	// It is reported by TariffDevice.PasswordLevel after the password is accepted.
+	Level int
+}
+
+// PasswordProvider supplies passwords for devices, e.g. from a secret store.
+type PasswordProvider interface {
+	// Password returns password for the device. An error aborts entering programming mode.
+	// ctx is the context passed to SignOnContext or CommandContext of TariffDevice, context.Background() otherwise.
+	Password(ctx context.Context, req PasswordRequest) (Password, error)
+}
+
+// Password implements PasswordProvider.
+func (f PasswordFunc) Password(_ context.Context, req PasswordRequest) (Password, error) {
+	ds, cmd := f(req.Operand)
+	return Password{Command: cmd, Value: ds}, nil
+}
+
+// WithPasswordProvider creates a client that authenticates on commands with passwords of p.
+func WithPasswordProvider(conn Conn, address string, p PasswordProvider) *TariffDevice {
+	t := WithPassword(conn, address, nil)
+	t.provider = p
+	return t
+}
+
+// PasswordLevel returns access level of the password accepted by device in the current programming mode session.
+// Zero means no password was accepted.
+func (t *TariffDevice) PasswordLevel() int {
+	return t.accessLevel
+}
+
+// passwordProvider returns configured password provider or nil.
+func (t *TariffDevice) passwordProvider() PasswordProvider {
+	if t.provider != nil {
+		return t.provider
+	}
+	if t.pass != nil {
+		return t.pass
+	}
+	return nil
+}
+
+// password requests password for access level from the provider.
+func (t *TariffDevice) password(ctx context.Context, p PasswordProvider, level int) (Password, error) {
+	pw, err := p.Password(ctx, PasswordRequest{
+		Address:  t.address,
+		Identity: *t.identity,
+		Operand:  t.operand,
+		Level:    level,
+	})
+	if err != nil {
+		return pw, err
+	}
+	if pw.Command != CmdP1 && pw.Command != CmdP2 {
+		return pw, errors.New("password command must be P1 or P2")
+	}
+	return pw, nil
+}
@@ -0,0 +1,127 @@
+package iec62056
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testProvider struct {
+	req Password
+	err error
+	got PasswordRequest
+	ctx context.Context
+}
+
+func (p *testProvider) Password(ctx context.Context, req PasswordRequest) (Password, error) {
+	p.got = req
+	p.ctx = ctx
+	return p.req, p.err
+}
+
+func TestWithPasswordProvider(t *testing.T) {
+	errNotFound := errors.New("secret not found")
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	tests := []struct {
+		name      string
+		provider  *testProvider
+		reply     []byte
+		wantTx    string
+		wantLevel int
+		wantErr   error
+	}{
+		{
+			name:      "Clear text",
+			provider:  &testProvider{req: Password{Command: CmdP1, Value: DataSet{Value: "secret"}, Level: 2}},
+			reply:     []byte{ack},
+			wantTx:    "\x01P1\x02(secret)\x03",
+			wantLevel: 2,
+		},
+		{
+			name:      "Level not reported",
+			provider:  &testProvider{req: Password{Command: CmdP1, Value: DataSet{Value: "secret"}}},
+			reply:     []byte{ack},
+			wantTx:    "\x01P1\x02(secret)\x03",
+			wantLevel: 1,
+		},
+		{
+			name:     "Rejected",
+			provider: &testProvider{req: Password{Command: CmdP2, Value: DataSet{Value: "ABCD"}, Level: 3}},
+			reply:    []byte{nak, nak, nak, nak, nak},
+			wantTx:   "\x01P2\x02(ABCD)\x03",
+			wantErr:  ErrInvalidPassword,
+		},
+		{
+			name:     "Provider error",
+			provider: &testProvider{err: errNotFound},
+			wantErr:  errNotFound,
+		},
+		{
+			name:     "Invalid command",
+			provider: &testProvider{req: Password{Command: CmdR1}},
+			wantErr:  errors.New("password command must be P1 or P2"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.Write(tt.reply)
+			td := WithPasswordProvider(NewConn(&port, ConnOptions{}), "42", tt.provider)
+			td.identity = &Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, bri: '5'}
+			err := td.passExchange(ctx, []byte("(1234)"), 0)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("passExchange() error = %v, want %v", err, tt.wantErr)
+			}
+			want := PasswordRequest{Address: "42", Identity: *td.identity, Operand: DataSet{Value: "1234"}}
+			if !reflect.DeepEqual(tt.provider.got, want) {
+				t.Errorf("Password() request = %+v, want %+v", tt.provider.got, want)
+			}
+			if tt.provider.ctx != ctx {
+				t.Error("Password() context is not passed")
+			}
+			if tt.wantTx != "" && !bytes.HasPrefix(port.tx.Bytes(), []byte(tt.wantTx)) {
+				t.Errorf("sent %q, want %q", port.tx.Bytes(), tt.wantTx)
+			}
+			if td.PasswordLevel() != tt.wantLevel || td.programmingMode != (err == nil) {
+				t.Errorf("PasswordLevel() = %v, programming mode = %v", td.PasswordLevel(), td.programmingMode)
+			}
+		})
+	}
+}
+
+func TestPasswordFunc_Password(t *testing.T) {
+	f := PasswordFunc(func(arg DataSet) (DataSet, CommandId) {
+		return DataSet{Value: arg.Value + "!"}, CmdP2
+	})
+	got, err := f.Password(context.Background(), PasswordRequest{Operand: DataSet{Value: "op"}})
+	want := Password{Command: CmdP2, Value: DataSet{Value: "op!"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("PasswordFunc.Password() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestTariffDevice_SignOnContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	p0 := []byte("P0\x02(1234)\x03")
+	var port serialPort
+	port.rx.WriteString("/ABC5dev\r\n")
+	port.rx.WriteByte(soh)
+	port.rx.Write(p0)
+	port.rx.WriteByte(bcc(p0))
+	port.rx.WriteByte(ack)
+	provider := &testProvider{req: Password{Command: CmdP1, Value: DataSet{Value: "secret"}}}
+	td := WithPasswordProvider(NewConn(&port, ConnOptions{}), "", provider)
+	if err := td.SignOnContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if provider.ctx != ctx {
+		t.Error("SignOnContext() context is not passed to provider")
+	}
+	if !td.InProgrammingMode() {
+		t.Error("programming mode is not entered")
+	}
+}
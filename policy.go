@@ -0,0 +1,119 @@
+package iec62056
+
+import "errors"
+
+// ErrPolicy is matched by errors of commands refused by ReadOnly or WriteAllowlist of TariffDevice.
+var ErrPolicy = errors.New("command refused by policy")
+
+// PolicyError is returned when a write or execute command is refused before it is sent to device.
+// It matches ErrPolicy with errors.Is.
+type PolicyError struct {
+	// Refused command.
+	Command CommandId
+	// Data set address of the command.
+	Address string
+	// Reason of refusal.
+	Msg string
+}
+
+func (e *PolicyError) Error() string {
+	rv := "command " + e.Command.String()
+	if e.Address != "" {
+		rv += " to " + e.Address
+	}
+	return rv + " refused: " + e.Msg
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrPolicy
+}
+
+// checkPolicy returns *PolicyError if cmd is not permitted by ReadOnly and WriteAllowlist.
+func (t *TariffDevice) checkPolicy(cmd *Command) error {
+	if !isWriteCommand(cmd.Id) {
+		return nil
+	}
+	var address string
+	if cmd.Payload != nil {
+		address = cmd.Payload.Address
+	}
+	if t.ReadOnly {
+		return &PolicyError{Command: cmd.Id, Address: address, Msg: "read-only mode"}
+	}
+	if t.WriteAllowlist == nil {
+		return nil
+	}
+	if cmd.Raw != nil {
+		return &PolicyError{Command: cmd.Id, Msg: "raw payload is not checked against allowlist"}
+	}
+	for _, p := range t.WriteAllowlist {
+		if matchAddress(p, address) {
+			return nil
+		}
+	}
+	return &PolicyError{Command: cmd.Id, Address: address, Msg: "address is not in allowlist"}
+}
+
+// matchAddress reports whether data set address matches pattern.
+// OBIS value groups are delimited by '-', ':', '.', '*' and '&'.
+// In patterns "*" at the start of a group is a wildcard matching a whole non-empty group,
+// elsewhere it is the delimiter. "?" matches a single character of a group.
+// E.g. "1-0:1.8.*" matches "1-0:1.8.0" but neither "1-0:1.8.0*255" nor "1-0:1.8.",
+// "1-0:1.8.0**" matches "1-0:1.8.0*255".
+func matchAddress(pattern, address string) bool {
+	p := splitGroups(pattern, true)
+	a := splitGroups(address, false)
+	if len(p) != len(a) {
+		return false
+	}
+	for i := range p {
+		if i%2 == 1 {
+			// delimiter
+			if p[i] != a[i] {
+				return false
+			}
+			continue
+		}
+		if p[i] == "*" {
+			if a[i] == "" {
+				return false
+			}
+			continue
+		}
+		if len(p[i]) != len(a[i]) {
+			return false
+		}
+		for j := 0; j < len(p[i]); j++ {
+			if p[i][j] != '?' && p[i][j] != a[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// splitGroups splits address into value groups and delimiters in turn, starting with a group.
+// In patterns a group starting with "*" is the wildcard.
+func splitGroups(s string, pattern bool) []string {
+	var rv []string
+	from := 0
+	for i := 0; i < len(s); i++ {
+		if pattern && s[i] == '*' && i == from {
+			continue
+		}
+		if isGroupDelim(s[i]) {
+			rv = append(rv, s[from:i], s[i:i+1])
+			from = i + 1
+		}
+	}
+	return append(rv, s[from:])
+}
+
+// isWriteCommand reports whether id changes device state.
+func isWriteCommand(id CommandId) bool {
+	return id == CmdW1 || id == CmdW2 || id == CmdE2
+}
+
+func isGroupDelim(b byte) bool {
+	return b == '-' || b == ':' || b == '.' || b == '*' || b == '&'
+}
@@ -0,0 +1,130 @@
+package iec62056
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTariffDevice_checkPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		readOnly  bool
+		allowlist []string
+		cmd       Command
+		wantErr   error
+	}{
+		{
+			name:     "Read in read-only mode",
+			readOnly: true,
+			cmd:      Command{Id: CmdR1, Payload: &DataSet{Address: "1.8.0"}},
+		},
+		{
+			name:     "Write in read-only mode",
+			readOnly: true,
+			cmd:      Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "120000"}},
+			wantErr:  &PolicyError{Command: CmdW1, Address: "0.9.1", Msg: "read-only mode"},
+		},
+		{
+			name:     "Execute in read-only mode",
+			readOnly: true,
+			cmd:      Command{Id: CmdE2, Payload: &DataSet{Address: "C.1"}},
+			wantErr:  &PolicyError{Command: CmdE2, Address: "C.1", Msg: "read-only mode"},
+		},
+		{
+			name:      "Allowed",
+			allowlist: []string{"0.9.1", "0.9.2"},
+			cmd:       Command{Id: CmdW2, Payload: &DataSet{Address: "0.9.2", Value: "210101"}},
+		},
+		{
+			name:      "Wildcard",
+			allowlist: []string{"1-0:1.8.*"},
+			cmd:       Command{Id: CmdW1, Payload: &DataSet{Address: "1-0:1.8.1", Value: "0"}},
+		},
+		{
+			name:      "Wildcard does not cross groups",
+			allowlist: []string{"1-0:1.8.*"},
+			cmd:       Command{Id: CmdW1, Payload: &DataSet{Address: "1-0:1.8.1*255", Value: "0"}},
+			wantErr:   &PolicyError{Command: CmdW1, Address: "1-0:1.8.1*255", Msg: "address is not in allowlist"},
+		},
+		{
+			name:      "Not allowed",
+			allowlist: []string{"0.9.*"},
+			cmd:       Command{Id: CmdW1, Payload: &DataSet{Address: "1.8.0", Value: "0"}},
+			wantErr:   &PolicyError{Command: CmdW1, Address: "1.8.0", Msg: "address is not in allowlist"},
+		},
+		{
+			name:      "Empty allowlist",
+			allowlist: []string{},
+			cmd:       Command{Id: CmdE2, Payload: &DataSet{Address: "C.1"}},
+			wantErr:   &PolicyError{Command: CmdE2, Address: "C.1", Msg: "address is not in allowlist"},
+		},
+		{
+			name:      "Raw payload",
+			allowlist: []string{"*"},
+			cmd:       Command{Id: CmdW1, Raw: []byte("X(1)")},
+			wantErr:   &PolicyError{Command: CmdW1, Msg: "raw payload is not checked against allowlist"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := TariffDevice{ReadOnly: tt.readOnly, WriteAllowlist: tt.allowlist}
+			err := td.checkPolicy(&tt.cmd)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("checkPolicy() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTariffDevice_CommandReadOnly(t *testing.T) {
+	var port serialPort
+	td := NewTariffDevice(NewConn(&port, ConnOptions{}))
+	td.ReadOnly = true
+	_, err := td.Command(Command{Id: CmdW1, Payload: &DataSet{Address: "0.9.1", Value: "120000"}})
+	if !errors.Is(err, ErrPolicy) {
+		t.Errorf("Command() error = %v, want ErrPolicy", err)
+	}
+	if port.tx.Len() != 0 {
+		t.Errorf("sent %q", port.tx.Bytes())
+	}
+	td.programmingMode = true
+	td.lastActivity = time.Now()
+	if _, err = td.Command(Command{Id: CmdB0}); err != nil {
+		t.Errorf("break is refused: %v", err)
+	}
+}
+
+func Test_matchAddress(t *testing.T) {
+	tests := []struct {
+		pattern string
+		address string
+		want    bool
+	}{
+		{"1.8.0", "1.8.0", true},
+		{"1.8.0", "1.8.1", false},
+		{"1.8.*", "1.8.0", true},
+		{"1.8.*", "1.8.0*255", false},
+		{"1.8.*", "1.8", false},
+		{"1.8.*", "1.8.", false},
+		{"1.8.0**", "1.8.0*255", true},
+		{"1.8.0*255", "1.8.0*255", true},
+		{"1.8.0*255", "1.8.0*254", false},
+		{"1.8.***", "1.8.1*01", true},
+		{"1.8.0&*", "1.8.0&01", true},
+		{"1.8.?", "1.8.*", false},
+		{"1.*.0", "1.8.0", true},
+		{"1.*.0", "1.8.1.0", false},
+		{"*", "C.1", false},
+		{"C.1.?", "C.1.0", true},
+		{"C.1.?", "C.1.10", false},
+		{"1-0:*.8.0", "1-0:2.8.0", true},
+		{"1-0:*.8.0", "1-1:2.8.0", false},
+	}
+	for _, tt := range tests {
+		if got := matchAddress(tt.pattern, tt.address); got != tt.want {
+			t.Errorf("matchAddress(%q, %q) = %v, want %v", tt.pattern, tt.address, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package iec62056
+
+import "time"
+
+// bits transferred per character: start bit, 7 data bits, parity and stop bit.
+const bitsPerChar = 10
+
+// Progress describes the state of a data message reception.
+type Progress struct {
+	// Message bytes received so far.
+	Bytes int
+	// Data lines received so far.
+	Lines int
+	// Time since the message reception started.
+	Elapsed time.Duration
+	// Current baud rate of the connection.
+	BaudRate int
+	// Expected message size in bytes, 0 if unknown.
+	Expected int
+	// Estimated time to completion, 0 if unknown.
+	Remaining time.Duration
+}
+
+// Done reports the completed share of the message in range [0, 1], 0 if the expected size is unknown.
+func (p Progress) Done() float64 {
+	if p.Expected <= 0 {
+		return 0
+	}
+	if p.Bytes >= p.Expected {
+		return 1
+	}
+	return float64(p.Bytes) / float64(p.Expected)
+}
+
+// estimate calculates remaining time from the observed transfer rate or from the baud rate.
+func (p *Progress) estimate() {
+	left := p.Expected - p.Bytes
+	switch {
+	case p.Expected <= 0 || left <= 0:
+		p.Remaining = 0
+	case p.Bytes > 0 && p.Elapsed > 0:
+		p.Remaining = time.Duration(int64(p.Elapsed) / int64(p.Bytes) * int64(left))
+	case p.BaudRate > 0:
+		p.Remaining = transmitTime(left, p.BaudRate)
+	}
+}
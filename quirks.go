@@ -0,0 +1,86 @@
+package iec62056
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quirks describes known deviations of devices from IEC 62056-21.
+type Quirks struct {
+	// Validation of data messages of the device used when TariffDevice.Validation is DefaultValidation,
+	// e.g. Lenient for devices that omit CR LF before "!".
+	Validation Validation
+	// Number of extra bytes sent by device after block check character that are discarded.
+	TrailingBytes int
+	// Pause before every request to devices that need longer reaction time.
+	RequestDelay time.Duration
+	// Value of the data message sent by device instead of ACK when the password is accepted, e.g. "OK".
+	// Other replies are reported as errors.
+	PasswordReply string
+	// Error message values sent in reply to W1, W2 and E2 commands refused for insufficient access level,
+	// e.g. "ERR04". Command reports such replies as *AccessError.
+	AccessDenied []string
+}
+
+// quirks registry keyed by upper case manufacturer FLAG ID.
+// It is initialized with built-in quirks of common vendors.
+var quirks = struct {
+	sync.RWMutex
+	m map[string]Quirks
+}{m: map[string]Quirks{
+	// data messages without CR LF before "!"
+	"ISK": {Validation: Lenient},
+	// CR LF sent after block check character
+	"ELS": {TrailingBytes: 2},
+	// reaction time longer than 200 ms
+	"EMH": {RequestDelay: 300 * time.Millisecond},
+	// password accepted with (OK) instead of ACK
+	"ABB": {PasswordReply: "OK"},
+}}
+
+// RegisterQuirks registers quirks of devices of manufacturer, e.g. "ABC".
+// It replaces previous registration including built-in one.
+// Manufacturer is matched case-insensitively.
+func RegisterQuirks(manufacturer string, q Quirks) {
+	quirks.Lock()
+	defer quirks.Unlock()
+	quirks.m[strings.ToUpper(manufacturer)] = q
+}
+
+// LookupQuirks returns quirks registered for manufacturer or built-in ones.
+func LookupQuirks(manufacturer string) (Quirks, bool) {
+	quirks.RLock()
+	defer quirks.RUnlock()
+	q, ok := quirks.m[strings.ToUpper(manufacturer)]
+	return q, ok
+}
+
+// quirks returns quirks of the connected device. Quirks field overrides the registry.
+func (t *TariffDevice) quirks() Quirks {
+	if t.Quirks != nil {
+		return *t.Quirks
+	}
+	if t.identity == nil {
+		return Quirks{}
+	}
+	q, _ := LookupQuirks(t.identity.Manufacturer)
+	return q
+}
+
+// requestDelay pauses before a request if the device needs longer reaction time.
+func (t *TariffDevice) requestDelay() {
+	if d := t.quirks().RequestDelay; d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// skipTrailing discards extra bytes sent by device after block check character.
+func (t *TariffDevice) skipTrailing() error {
+	for i := t.quirks().TrailingBytes; i > 0; i-- {
+		if _, err := t.connection.ReadByte(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
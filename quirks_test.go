@@ -0,0 +1,121 @@
+package iec62056
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLookupQuirks(t *testing.T) {
+	if _, ok := LookupQuirks("XYZ"); ok {
+		t.Error("LookupQuirks(XYZ) found")
+	}
+	RegisterQuirks("xyz", Quirks{TrailingBytes: 1})
+	defer func() {
+		quirks.Lock()
+		delete(quirks.m, "XYZ")
+		quirks.Unlock()
+	}()
+	if q, ok := LookupQuirks("XYz"); !ok || q.TrailingBytes != 1 {
+		t.Errorf("LookupQuirks(XYz) = %v, %v", q, ok)
+	}
+}
+
+func TestTariffDevice_Quirks(t *testing.T) {
+	RegisterQuirks("QRK", Quirks{Validation: Lenient, TrailingBytes: 2, RequestDelay: time.Millisecond})
+	defer func() {
+		quirks.Lock()
+		delete(quirks.m, "QRK")
+		quirks.Unlock()
+	}()
+	body := []byte("A(1)\r\nB(2)!\r\n\x03")
+	tests := []struct {
+		name       string
+		ident      string
+		validation Validation
+		quirks     *Quirks
+		wantErr    bool
+	}{
+		{name: "Registered", ident: "/QRK5dev\r\n"},
+		{name: "Built-in", ident: "/ELS5dev\r\n"},
+		{name: "Not registered", ident: "/XYZ5dev\r\n", validation: Strict, wantErr: true},
+		{name: "Strict wins over quirks", ident: "/QRK5dev\r\n", validation: Strict, wantErr: true},
+		{name: "Override", ident: "/QRK5dev\r\n", quirks: &Quirks{Validation: Strict, TrailingBytes: 2}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.WriteString(tt.ident)
+			port.rx.WriteByte(stx)
+			port.rx.Write(body)
+			port.rx.WriteByte(bcc(body))
+			port.rx.WriteString("\r\n")
+			td := NewTariffDevice(NewConn(&port, ConnOptions{}))
+			td.Validation = tt.validation
+			td.Quirks = tt.quirks
+			db, err := td.ReadOut()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadOut() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(db.Lines) != 2 {
+				t.Errorf("ReadOut() = %v", db)
+			}
+			if b, err := td.connection.ReadByte(); err == nil {
+				t.Errorf("trailing bytes are not discarded, read %q", b)
+			}
+		})
+	}
+}
+
+func TestTariffDevice_SignOnTrailingBytes(t *testing.T) {
+	p0 := []byte("P0\x02(1234)\x03")
+	var port serialPort
+	port.rx.WriteString("/ABC5dev\r\n")
+	port.rx.WriteByte(soh)
+	port.rx.Write(p0)
+	port.rx.WriteByte(bcc(p0))
+	port.rx.WriteString("\r\n")
+	port.rx.WriteByte(ack)
+	provider := &testProvider{req: Password{Command: CmdP1, Value: DataSet{Value: "secret"}}}
+	td := WithPasswordProvider(NewConn(&port, ConnOptions{}), "", provider)
+	td.Quirks = &Quirks{TrailingBytes: 2}
+	if err := td.SignOn(); err != nil {
+		t.Fatal(err)
+	}
+	if !td.InProgrammingMode() {
+		t.Error("programming mode is not entered")
+	}
+}
+
+func TestTariffDevice_PasswordReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		quirk   string
+		reply   string
+		wantErr bool
+	}{
+		{name: "Not configured", reply: "(OK)\x03", wantErr: true},
+		{name: "Accepted", quirk: "OK", reply: "(OK)\x03"},
+		{name: "Error message", quirk: "OK", reply: "(ERROR)\x03", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.WriteByte(stx)
+			port.rx.WriteString(tt.reply)
+			port.rx.WriteByte(bcc([]byte(tt.reply)))
+			td := WithPassword(NewConn(&port, ConnOptions{}), "", func(DataSet) (DataSet, CommandId) {
+				return DataSet{Value: "pass"}, CmdP1
+			})
+			td.identity = &Identity{Manufacturer: "ABC", Mode: ModeC, bri: '5'}
+			td.Quirks = &Quirks{PasswordReply: tt.quirk}
+			err := td.passExchange(context.Background(), []byte("(1234)"), 0)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("passExchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
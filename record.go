@@ -0,0 +1,364 @@
+package iec62056
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrReplayMismatch is returned by a replayed connection when the client deviates from the recorded session.
+var ErrReplayMismatch = errors.New("request does not match recorded session")
+
+// recorded session event kinds.
+const (
+	eventRequest  = ">"
+	eventResponse = "<"
+	eventBaudRate = "baud"
+)
+
+// recordedEvent is a single line of a recorded session.
+type recordedEvent struct {
+	// offset from the start of recording.
+	at time.Duration
+	// one of eventRequest, eventResponse or eventBaudRate.
+	kind string
+	// frame bytes for requests and responses.
+	data []byte
+	// baud rate for eventBaudRate.
+	baudRate int
+}
+
+// String formats an event as a session file line.
+func (e *recordedEvent) String() string {
+	var value string
+	if e.kind == eventBaudRate {
+		value = strconv.Itoa(e.baudRate)
+	} else {
+		value = strings.ToUpper(hex.EncodeToString(e.data))
+	}
+	return fmt.Sprintf("%s %s %s", e.at, e.kind, value)
+}
+
+// parseEvent parses a session file line.
+func parseEvent(line string) (recordedEvent, error) {
+	var e recordedEvent
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return e, fmt.Errorf("malformed session line %q", line)
+	}
+	at, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return e, err
+	}
+	e.at = at
+	e.kind = fields[1]
+	switch e.kind {
+	case eventRequest, eventResponse:
+		e.data, err = hex.DecodeString(fields[2])
+	case eventBaudRate:
+		e.baudRate, err = strconv.Atoi(fields[2])
+	default:
+		err = fmt.Errorf("unknown session event %q", e.kind)
+	}
+	return e, err
+}
+
+// recordingConn wraps a connection and saves every frame into a session file.
+type recordingConn struct {
+	Conn
+	// session sink
+	w io.Writer
+	// recording start time
+	start time.Time
+	// bytes received for the current response frame
+	rx bytes.Buffer
+	// first byte of the current response frame reception time
+	rxAt time.Time
+	// bytes written for the current request frame
+	tx bytes.Buffer
+	// first byte of the current request frame write time
+	txAt time.Time
+	// first error of writing into the sink
+	err error
+}
+
+// Record wraps a connection and writes every request and response frame
+// with its direction and timing into w. Baud rate changes are recorded as well.
+// The session can be served back with Replay.
+// Errors writing to w are reported by Close.
+func Record(c Conn, w io.Writer) Conn {
+	return &recordingConn{
+		Conn:  c,
+		w:     w,
+		start: time.Now(),
+	}
+}
+
+func (r *recordingConn) emit(e recordedEvent) {
+	if r.err != nil {
+		return
+	}
+	_, r.err = fmt.Fprintln(r.w, e.String())
+}
+
+// flushRx saves collected response bytes as a frame.
+func (r *recordingConn) flushRx() {
+	if r.rx.Len() == 0 {
+		return
+	}
+	r.emit(recordedEvent{
+		at:   r.rxAt.Sub(r.start),
+		kind: eventResponse,
+		data: r.rx.Bytes(),
+	})
+	r.rx.Reset()
+}
+
+func (r *recordingConn) received(data ...byte) {
+	if len(data) == 0 {
+		return
+	}
+	if r.rx.Len() == 0 {
+		r.rxAt = time.Now()
+	}
+	r.rx.Write(data)
+}
+
+func (r *recordingConn) sent(data ...byte) {
+	if len(data) == 0 {
+		return
+	}
+	if r.tx.Len() == 0 {
+		r.txAt = time.Now()
+	}
+	r.tx.Write(data)
+}
+
+func (r *recordingConn) PrepareWrite() error {
+	r.flushRx()
+	r.tx.Reset()
+	return r.Conn.PrepareWrite()
+}
+
+func (r *recordingConn) PrepareRead() error {
+	r.flushRx()
+	return r.Conn.PrepareRead()
+}
+
+func (r *recordingConn) LogResponse() {
+	r.flushRx()
+	r.Conn.LogResponse()
+}
+
+func (r *recordingConn) ReadByte() (byte, error) {
+	b, err := r.Conn.ReadByte()
+	if err == nil {
+		r.received(b)
+	}
+	return b, err
+}
+
+func (r *recordingConn) ReadBytes(delim byte) ([]byte, error) {
+	data, err := r.Conn.ReadBytes(delim)
+	r.received(data...)
+	return data, err
+}
+
+func (r *recordingConn) Write(data []byte) (int, error) {
+	n, err := r.Conn.Write(data)
+	r.sent(data[:n]...)
+	return n, err
+}
+
+func (r *recordingConn) WriteByte(data byte) error {
+	err := r.Conn.WriteByte(data)
+	if err == nil {
+		r.sent(data)
+	}
+	return err
+}
+
+func (r *recordingConn) Flush() error {
+	err := r.Conn.Flush()
+	if err == nil && r.tx.Len() != 0 {
+		r.emit(recordedEvent{
+			at:   r.txAt.Sub(r.start),
+			kind: eventRequest,
+			data: r.tx.Bytes(),
+		})
+	}
+	r.tx.Reset()
+	return err
+}
+
+func (r *recordingConn) SetBaudRate(rate int) error {
+	r.flushRx()
+	err := r.Conn.SetBaudRate(rate)
+	if err == nil {
+		r.emit(recordedEvent{
+			at:       time.Since(r.start),
+			kind:     eventBaudRate,
+			baudRate: rate,
+		})
+	}
+	return err
+}
+
+func (r *recordingConn) Close() error {
+	r.flushRx()
+	err := r.Conn.Close()
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+// ReplayConn is a connection that serves a recorded session back to the client.
+// Every request written by the client and every baud rate change is verified against the recording.
+// Reads beyond the recorded responses return io.EOF.
+type ReplayConn struct {
+	// recorded session
+	events []recordedEvent
+	// next event index
+	pos int
+	// unread bytes of the current response
+	rx []byte
+	// request bytes written since last flush
+	tx bytes.Buffer
+}
+
+// Replay reads a session recorded with Record and returns a connection that plays it back.
+func Replay(r io.Reader) (*ReplayConn, error) {
+	var rc ReplayConn
+	s := bufio.NewScanner(r)
+	// frames are hex encoded
+	s.Buffer(nil, 2*defaultMaxFrameSize+64)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		e, err := parseEvent(line)
+		if err != nil {
+			return nil, err
+		}
+		rc.events = append(rc.events, e)
+	}
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+	return &rc, nil
+}
+
+// Done reports whether the whole recorded session was played back.
+func (r *ReplayConn) Done() bool {
+	return r.pos == len(r.events) && len(r.rx) == 0
+}
+
+// mismatch formats an error for unexpected client behaviour.
+func (r *ReplayConn) mismatch(got string) error {
+	want := "end of session"
+	if r.pos < len(r.events) {
+		want = r.events[r.pos].String()
+	}
+	return fmt.Errorf("%w: got %s, want %s", ErrReplayMismatch, got, want)
+}
+
+// nextResponse moves the following recorded response into the read buffer.
+func (r *ReplayConn) nextResponse() error {
+	for len(r.rx) == 0 {
+		if r.pos == len(r.events) || r.events[r.pos].kind != eventResponse {
+			return io.EOF
+		}
+		r.rx = r.events[r.pos].data
+		r.pos++
+	}
+	return nil
+}
+
+func (r *ReplayConn) PrepareWrite() error {
+	r.tx.Reset()
+	return nil
+}
+
+func (r *ReplayConn) PrepareRead() error {
+	return nil
+}
+
+func (r *ReplayConn) LogRequest() {}
+
+func (r *ReplayConn) LogResponse() {}
+
+func (r *ReplayConn) ReadByte() (byte, error) {
+	if err := r.nextResponse(); err != nil {
+		return 0, err
+	}
+	b := r.rx[0]
+	r.rx = r.rx[1:]
+	return b, nil
+}
+
+func (r *ReplayConn) ReadBytes(delim byte) ([]byte, error) {
+	var rv []byte
+	for {
+		if err := r.nextResponse(); err != nil {
+			return rv, err
+		}
+		if i := bytes.IndexByte(r.rx, delim); i >= 0 {
+			rv = append(rv, r.rx[:i+1]...)
+			r.rx = r.rx[i+1:]
+			return rv, nil
+		}
+		rv = append(rv, r.rx...)
+		r.rx = nil
+	}
+}
+
+func (r *ReplayConn) Write(data []byte) (int, error) {
+	return r.tx.Write(data)
+}
+
+func (r *ReplayConn) WriteByte(data byte) error {
+	return r.tx.WriteByte(data)
+}
+
+// Flush verifies written request against the recorded one.
+// Unread bytes of the previous response are discarded.
+func (r *ReplayConn) Flush() error {
+	if r.tx.Len() == 0 {
+		return nil
+	}
+	got := recordedEvent{kind: eventRequest, data: r.tx.Bytes()}
+	r.rx = nil
+	for r.pos < len(r.events) && r.events[r.pos].kind == eventResponse {
+		r.pos++
+	}
+	if r.pos == len(r.events) || r.events[r.pos].kind != eventRequest ||
+		!bytes.Equal(r.events[r.pos].data, got.data) {
+		return r.mismatch(got.String())
+	}
+	r.pos++
+	r.tx.Reset()
+	return nil
+}
+
+// SetBaudRate verifies baud rate change against the recorded one.
+func (r *ReplayConn) SetBaudRate(rate int) error {
+	got := recordedEvent{kind: eventBaudRate, baudRate: rate}
+	if len(r.rx) == 0 && r.pos < len(r.events) &&
+		r.events[r.pos].kind == eventBaudRate && r.events[r.pos].baudRate == rate {
+		r.pos++
+		return nil
+	}
+	return r.mismatch(got.String())
+}
+
+func (r *ReplayConn) Close() error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package iec62056
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	server, client := listen()
+	defer server.Close()
+
+	var session bytes.Buffer
+	td := NewTariffDevice(Record(client, &session))
+	go func() {
+		buf := make([]byte, 5)
+		_, _ = server.Read(buf)
+		_, _ = server.Write([]byte("/iek6test\r\n"))
+		buf = make([]byte, 6)
+		_, _ = server.Read(buf)
+		var b bytes.Buffer
+		b.WriteString("Data(Val)!\r\n")
+		b.WriteByte(etx)
+		_, _ = server.Write([]byte{stx})
+		_, _ = server.Write(b.Bytes())
+		_, _ = server.Write([]byte{bcc(b.Bytes())})
+	}()
+	want, err := td.ReadOut()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = td.connection.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := Replay(bytes.NewReader(session.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewTariffDevice(rc).ReadOut()
+	if err != nil {
+		t.Fatalf("replay failed: %v\n%s", err, session.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Replay ReadOut() = %v, want %v", got, want)
+	}
+	if !rc.Done() {
+		t.Error("session is not played back completely")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name         string
+		session      string
+		address      string
+		wantParseErr bool
+		wantErr      error
+	}{
+		{
+			name:         "Malformed line",
+			session:      "0s > 2",
+			wantParseErr: true,
+		},
+		{
+			name: "Identity",
+			session: "# comment\n0s baud 300\n1ms > 2F3F210D0A\n" +
+				"2ms < 2F69656B3674657374\n3ms < 0D0A\n",
+		},
+		{
+			name:    "Unexpected request",
+			session: "0s baud 300\n1ms > 2F3F210D0A\n2ms < 2F69656B36746573740D0A\n",
+			address: "1",
+			wantErr: ErrReplayMismatch,
+		},
+		{
+			name:    "Unexpected baud rate",
+			session: "0s baud 9600\n",
+			wantErr: ErrReplayMismatch,
+		},
+		{
+			name:    "No response",
+			session: "0s baud 300\n1ms > 2F3F210D0A\n",
+			wantErr: io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := Replay(strings.NewReader(tt.session))
+			if (err != nil) != tt.wantParseErr {
+				t.Fatalf("Replay() error = %v, wantErr %v", err, tt.wantParseErr)
+			}
+			if tt.wantParseErr {
+				return
+			}
+			_, err = WithAddress(rc, tt.address).Identity()
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("Identity() error = %v", err)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("Identity() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplay_LargeFrame(t *testing.T) {
+	frame := strings.Repeat("41", 40*1024)
+	rc, err := Replay(strings.NewReader("0s baud 300\n1ms < " + frame + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.events) != 2 || len(rc.events[1].data) != 40*1024 {
+		t.Errorf("Replay() events = %v", len(rc.events))
+	}
+}
+
+// writes to failingPort fail.
+type failingPort struct {
+	serialPort
+}
+
+func (p *failingPort) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRecord_FlushError(t *testing.T) {
+	var session bytes.Buffer
+	c := Record(NewConn(&failingPort{}, ConnOptions{}), &session)
+	_ = c.PrepareWrite()
+	_, _ = c.Write([]byte("/?!\r\n"))
+	if err := c.Flush(); err == nil {
+		t.Fatal("Flush() error is not returned")
+	}
+	if strings.Contains(session.String(), ">") {
+		t.Errorf("failed request is recorded:\n%s", session.String())
+	}
+}
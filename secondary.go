@@ -0,0 +1,84 @@
+package iec62056
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrReleased is returned by operations on a released secondary protocol handle.
+var ErrReleased = errors.New("secondary protocol handle is released")
+
+// SecondaryConn is a raw handle on the connection after switching device to a secondary protocol.
+// Reads and writes bypass IEC 62056-21 framing. Release returns the client to the protocol start state.
+type SecondaryConn struct {
+	t        *TariffDevice
+	released bool
+}
+
+// SecondaryProtocol sends option select message with secondary protocol control character,
+// switches the connection to the selected baud rate and returns a raw handle for a manufacturer protocol.
+// Available for ModeC only. The client must not be used until the handle is released.
+func (t *TariffDevice) SecondaryProtocol(o Option) (*SecondaryConn, error) {
+	if err := t.selectOption(OptionSelectMessage{Option: o, PCC: SecondaryPCC}); err != nil {
+		return nil, err
+	}
+	return &SecondaryConn{t: t}, nil
+}
+
+// Read reads raw bytes received from device.
+func (s *SecondaryConn) Read(p []byte) (int, error) {
+	if s.released {
+		return 0, ErrReleased
+	}
+	c := s.t.connection
+	if err := c.PrepareRead(); err != nil {
+		return 0, err
+	}
+	if r, ok := c.(io.Reader); ok {
+		return r.Read(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b, err := c.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	p[0] = b
+	return 1, nil
+}
+
+// Write sends raw bytes to device.
+func (s *SecondaryConn) Write(p []byte) (int, error) {
+	if s.released {
+		return 0, ErrReleased
+	}
+	c := s.t.connection
+	if err := c.PrepareWrite(); err != nil {
+		return 0, err
+	}
+	n, err := c.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.Flush()
+}
+
+// SetBaudRate changes baud rate of the connection if the secondary protocol requires it.
+func (s *SecondaryConn) SetBaudRate(rate int) error {
+	if s.released {
+		return ErrReleased
+	}
+	return s.t.setBaudRate(rate)
+}
+
+// Release restores the initial baud rate of 300 and moves protocol to start state,
+// so the next request begins with a new handshake. It is safe to call Release more than once.
+func (s *SecondaryConn) Release() error {
+	if s.released {
+		return nil
+	}
+	s.released = true
+	s.t.DropProgrammingMode()
+	return s.t.setBaudRate(300)
+}
@@ -0,0 +1,61 @@
+package iec62056
+
+import (
+	"io"
+	"testing"
+)
+
+func TestTariffDevice_SecondaryProtocol(t *testing.T) {
+	var port serialPort
+	port.rx.WriteString("/ABC5dev\r\n")
+	port.rx.WriteString("\x7e\x01\x7e")
+	td := NewTariffDevice(NewConn(&port, ConnOptions{}))
+	td.MaxBaudRate = 4800
+	s, err := td.SecondaryProtocol(Option6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := port.tx.String(), "/?!\r\n\x06146\r\n"; got != want {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+	if port.baudRate != 4800 {
+		t.Errorf("baud rate = %v, want 4800", port.baudRate)
+	}
+	port.tx.Reset()
+	if _, err = s.Write([]byte{0x7e, 0x02, 0x7e}); err != nil {
+		t.Fatal(err)
+	}
+	if port.tx.String() != "\x7e\x02\x7e" {
+		t.Errorf("Write() sent %q", port.tx.String())
+	}
+	buf := make([]byte, 3)
+	if _, err = io.ReadFull(s, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "\x7e\x01\x7e" {
+		t.Errorf("Read() = %q", buf)
+	}
+	if err = s.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if port.baudRate != 300 || td.identity != nil {
+		t.Errorf("Release() baud rate = %v, identity = %v", port.baudRate, td.identity)
+	}
+	if _, err = s.Write([]byte{0}); err != ErrReleased {
+		t.Errorf("Write() after release error = %v", err)
+	}
+	if err = s.Release(); err != nil {
+		t.Errorf("second Release() error = %v", err)
+	}
+}
+
+func TestTariffDevice_OptionSecondaryPCC(t *testing.T) {
+	var port serialPort
+	td := NewTariffDevice(NewConn(&port, ConnOptions{}))
+	if _, err := td.Option(OptionSelectMessage{Option: Option6, PCC: SecondaryPCC}); err == nil {
+		t.Error("Option() expected error for secondary protocol")
+	}
+	if port.tx.Len() != 0 {
+		t.Errorf("sent %q", port.tx.String())
+	}
+}
@@ -1,6 +1,7 @@
 package iec62056
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -13,16 +14,59 @@ var ErrInvalidFrame = errors.New("invalid frame received")
 // and returns encoded value.
 // For clear text passwords return CommandId.CmdP1
 // For encoded passwords using operand return CommandId.P2
+// PasswordFunc implements PasswordProvider.
 type PasswordFunc func(arg DataSet) (DataSet, CommandId)
 
 // TariffDevice is a client that communicates using IEC-62056-21 protocol.
 type TariffDevice struct {
 	//Timeout after device is reset from programming mode
 	IdleTimeout time.Duration
+	// Optional callback reporting data message reception progress of ReadOut and Option.
+	// It is called on every received data line and on completion.
+	Progress func(Progress)
+	// Typical data message size in bytes, e.g. from a previous run, used for completion estimate.
+	// If zero, the size of the last data message received by this client is used.
+	ExpectedSize int
+	// Validation of data messages received by ReadOut and Option.
+	// DefaultValidation applies Quirks of the device, Lenient if they do not select validation.
+	Validation Validation
+	// Optional wake-up sequence sent before the request message, e.g. for battery-powered meters.
+	WakeUp *WakeUp
+	// Maximum baud rate supported by the link. Zero means no limit.
+	// Mode C option select message requests the highest rate not exceeding both the limit and the device offer.
+	// Mode B devices switch to the advertised rate on their own and are not limited.
+	MaxBaudRate int
+	// Optional Mode C baud rate selection by device identity, e.g. per manufacturer.
+	// The returned rate is limited by the device offer and MaxBaudRate.
+	BaudPolicy func(id Identity) int
+	// Device quirks. If nil then quirks registered for the device manufacturer are applied.
+	Quirks *Quirks
+	// Access level requested from PasswordProvider on entering programming mode.
+	// Zero lets the provider choose the password. See Elevate for raising the level later.
+	SignOnLevel int
+	// If true then W1, W2 and E2 commands are refused with *PolicyError before anything is sent to device.
+	ReadOnly bool
+	// Optional data set addresses permitted for W1, W2 and E2 commands, others are refused with *PolicyError.
+	// Patterns may contain wildcards, "*" in place of an OBIS value group matches any non-empty group
+	// and "?" matches a single character, e.g. "1-0:1.8.*", "1-0:1.8.0**" or "C.1.?".
+	// Commands with Raw payload are refused if the list is set. Nil permits all addresses.
+	WriteAllowlist []string
+	// Optional sink of audit records of W1, W2 and E2 commands passed to Command,
+	// including commands refused by the policy or failed to enter programming mode.
+	Audit AuditSink
+	// If true then the value of the address is read with R1 or R2 before W1 or W2 command
+	// and recorded as the previous value of the audit record.
+	AuditPreRead bool
 	// Device address
 	address string
 	// Password callback
 	pass PasswordFunc
+	// Password provider, takes precedence over callback
+	provider PasswordProvider
+	// level of the accepted password
+	accessLevel int
+	// operand of the password request of the session
+	operand DataSet
 	//TCP connection
 	connection Conn
 	// state flag
@@ -31,6 +75,10 @@ type TariffDevice struct {
 	lastActivity time.Time
 	// Identity message received on handshake
 	identity *Identity
+	// current connection baud rate
+	baudRate int
+	// size of the last received data message
+	lastSize int
 }
 
 // NewTariffDevice creates a client for broadcast messages
@@ -63,6 +111,7 @@ func (t *TariffDevice) Reset(conn Conn) {
 func (t *TariffDevice) DropProgrammingMode() {
 	t.programmingMode = false
 	t.identity = nil
+	t.accessLevel = 0
 }
 
 // Retrieves or reads identity message form device
@@ -70,7 +119,7 @@ func (t *TariffDevice) Identity() (Identity, error) {
 	if t.identity != nil {
 		return *t.identity, nil
 	}
-	if _, err := t.handShake(); err != nil {
+	if err := t.handShake(nil); err != nil {
 		return Identity{}, err
 	}
 	return *t.identity, nil
@@ -78,82 +127,152 @@ func (t *TariffDevice) Identity() (Identity, error) {
 
 // Reads Read Out message from device. Works for ModeA, ModeB and ModeC
 func (t *TariffDevice) ReadOut() (*DataBlock, error) {
-	data, err := t.handShake()
+	var rv DataBlock
+	err := t.ReadOutFunc(func(dl DataLine) error {
+		rv.Lines = append(rv.Lines, dl)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return &rv, nil
+}
+
+// Reads Read Out message from device calling fn for every data line as it is received.
+// Works for ModeA, ModeB and ModeC
+func (t *TariffDevice) ReadOutFunc(fn func(DataLine) error) error {
+	if err := t.handShake(fn); err != nil {
+		return err
+	}
 
 	if t.identity.Mode != ModeC {
-		return data, nil
+		return nil
 	}
-	data, err = t.Option(OptionSelectMessage{
+	return t.option(context.Background(), OptionSelectMessage{
 		Option:        DataReadOut,
 		PCC:           NormalPCC,
 		skipHandShake: true,
+	}, fn)
+}
+
+// Requests an Option from device. Available for ModeC only
+// Manufacturer specific options registered with RegisterOptionHandler are processed by the handler.
+func (t *TariffDevice) Option(o OptionSelectMessage) (*DataBlock, error) {
+	var rv DataBlock
+	err := t.option(context.Background(), o, func(dl DataLine) error {
+		rv.Lines = append(rv.Lines, dl)
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return data, nil
+	if o.Option == ProgrammingMode {
+		return nil, nil
+	}
+	return &rv, nil
 }
 
-// Requests an Option from device. Available for ModeC only
-func (t *TariffDevice) Option(o OptionSelectMessage) (*DataBlock, error) {
-	if !o.skipHandShake {
-		_, err := t.handShake()
+func (t *TariffDevice) option(ctx context.Context, o OptionSelectMessage, fn func(DataLine) error) error {
+	if o.PCC == SecondaryPCC {
+		return errors.New("use SecondaryProtocol for secondary protocol option select")
+	}
+	if err := t.selectOption(o); err != nil {
+		return err
+	}
+
+	if o.Option == ProgrammingMode {
+		return t.signOn(ctx, t.SignOnLevel)
+	}
+
+	if h := lookupOptionHandler(t.identity.Manufacturer, o.Option); h != nil {
+		db, err := h(t.connection, *t.identity)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		t.lastActivity = time.Now()
+		if db == nil || fn == nil {
+			return nil
+		}
+		for _, dl := range db.Lines {
+			if err = fn(dl); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := t.readData(fn); err != nil {
+		return err
+	}
+	t.lastActivity = time.Now()
+	return nil
+}
+
+// selectOption sends option select message and switches the connection to the selected baud rate.
+func (t *TariffDevice) selectOption(o OptionSelectMessage) error {
+	if !o.skipHandShake {
+		if err := t.handShake(nil); err != nil {
+			return err
 		}
 	}
 	if t.identity.Mode != ModeC {
 		err := errors.New("Option selection is available for Mode C only")
-		return nil, err
+		return err
 	}
-	o.bri = t.identity.bri
-	data, err := o.MarshalBinary()
+	rate, err := t.selectBaudRate()
 	if err != nil {
-		return nil, err
-	}
-
-	t.programmingMode = false
-	if err := writeMessage(t.connection, data); err != nil {
-		return nil, err
+		return err
 	}
-	if err := t.connection.SetBaudRate(decodeBaudRate(t.identity.bri)); err != nil {
-		return nil, err
+	if o.bri, err = encodeBaudRate(ModeC, rate); err != nil {
+		return err
 	}
-
-	data, err = readMessage(t.connection)
+	data, err := o.MarshalBinary()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	t.lastActivity = time.Now()
 
-	if o.Option == ProgrammingMode {
-		err = t.passExchange(data)
-		return nil, err
-	}
-	var rv DataBlock
-	err = rv.UnmarshalBinary(data)
-	if err != nil {
-		return nil, err
+	t.programmingMode = false
+	t.accessLevel = 0
+	t.requestDelay()
+	if err := writeMessage(t.connection, data); err != nil {
+		return err
 	}
-	return &rv, nil
+	return t.setBaudRate(rate)
 }
 
 // Sends command to device. Result can be either response message or error message
 func (t *TariffDevice) Command(cmd Command) (*DataBlock, error) {
+	return t.CommandContext(context.Background(), cmd)
+}
+
+// CommandContext sends command to device like Command.
+// ctx is passed to PasswordProvider if the command enters programming mode.
+func (t *TariffDevice) CommandContext(ctx context.Context, cmd Command) (*DataBlock, error) {
 	if cmd.Id == CmdB0 {
 		return nil, t.SendBreak()
 	}
+	if t.Audit != nil && isWriteCommand(cmd.Id) {
+		return t.auditCommand(ctx, cmd)
+	}
+	if err := t.prepareCommand(ctx, &cmd); err != nil {
+		return nil, err
+	}
+	return t.command(cmd)
+}
 
-	if !t.isInProgrammingMode() {
-		err := t.enterProgrammingMode()
-		if err != nil {
-			return nil, err
-		}
+// prepareCommand checks cmd against the policy and enters programming mode if needed.
+func (t *TariffDevice) prepareCommand(ctx context.Context, cmd *Command) error {
+	if err := t.checkPolicy(cmd); err != nil {
+		return err
+	}
+	if t.isInProgrammingMode() {
+		return nil
 	}
+	return t.enterProgrammingMode(ctx, t.SignOnLevel)
+}
 
+// command sends cmd in programming mode and parses the reply.
+func (t *TariffDevice) command(cmd Command) (*DataBlock, error) {
 	data, err := cmd.MarshalBinary()
 	if err != nil {
 		return nil, err
@@ -163,6 +282,12 @@ func (t *TariffDevice) Command(cmd Command) (*DataBlock, error) {
 		return nil, err
 	}
 	var db DataBlock
+	if data[0] == ack {
+		return &db, nil
+	}
+	if reply, ok := t.accessDenied(cmd.Id, data); ok {
+		return nil, &AccessError{Command: cmd.Id, Level: t.accessLevel, Reply: reply}
+	}
 	err = db.UnmarshalBinary(data)
 	if err != nil {
 		return nil, err
@@ -175,25 +300,48 @@ func (t *TariffDevice) SendBreak() error {
 	err := writeMessage(t.connection, breakMsg)
 	t.identity = nil
 	t.programmingMode = false
+	t.accessLevel = 0
 	return err
 }
 
-func (t *TariffDevice) enterProgrammingMode() error {
-	_, err := t.handShake()
+// Signs on to device and enters programming mode unless it is already active.
+func (t *TariffDevice) SignOn() error {
+	return t.SignOnContext(context.Background())
+}
+
+// SignOnContext signs on to device like SignOn. ctx is passed to PasswordProvider.
+func (t *TariffDevice) SignOnContext(ctx context.Context) error {
+	if t.isInProgrammingMode() {
+		return nil
+	}
+	return t.enterProgrammingMode(ctx, t.SignOnLevel)
+}
+
+// Reports whether programming mode is active and is not expired by IdleTimeout.
+func (t *TariffDevice) InProgrammingMode() bool {
+	return t.isInProgrammingMode()
+}
+
+// enterProgrammingMode signs on requesting password of access level from PasswordProvider.
+func (t *TariffDevice) enterProgrammingMode(ctx context.Context, level int) error {
+	err := t.handShake(nil)
 	if err != nil {
 		return err
 	}
 	if t.identity.Mode == ModeC {
-		_, err := t.Option(OptionSelectMessage{
+		err = t.selectOption(OptionSelectMessage{
 			Option:        ProgrammingMode,
 			PCC:           NormalPCC,
 			bri:           t.identity.bri,
 			skipHandShake: true,
 		})
-		return err
+		if err != nil {
+			return err
+		}
+		return t.signOn(ctx, level)
 	}
 
-	if t.pass == nil || t.identity.Mode != ModeB {
+	if t.passwordProvider() == nil || t.identity.Mode != ModeB {
 		return nil
 	}
 	ds := DataSet{
@@ -202,60 +350,43 @@ func (t *TariffDevice) enterProgrammingMode() error {
 		Unit:    "",
 	}
 	data, _ := ds.MarshalBinary()
-	return t.passExchange(data)
+	return t.passExchange(ctx, data, level)
 }
 
-func (t *TariffDevice) passExchange(p []byte) error {
-	var ds DataSet
-	err := ds.UnmarshalBinary(p)
+// signOn reads password request sent after programming mode option select and replies to it.
+func (t *TariffDevice) signOn(ctx context.Context, level int) error {
+	data, err := readMessage(t.connection)
 	if err != nil {
 		return err
 	}
-	ds.Address = ""
-
-	if t.pass == nil {
-		t.programmingMode = true
-		return nil
-	}
-	rv, cmd := t.pass(ds)
-
-	passCmd := &Command{
-		Id:      cmd,
-		Payload: &rv,
-	}
-
-	data, err := passCmd.MarshalBinary()
-	if err != nil {
+	if err = t.skipTrailing(); err != nil {
 		return err
 	}
-	data, err = t.cmd(data)
+	t.lastActivity = time.Now()
+	return t.passExchange(ctx, data, level)
+}
+
+func (t *TariffDevice) passExchange(ctx context.Context, p []byte, level int) error {
+	var ds DataSet
+	err := ds.UnmarshalBinary(p)
 	if err != nil {
-		if err == ErrNAK {
-			return ErrInvalidPassword
-		}
 		return err
 	}
+	ds.Address = ""
 
-	if data[0] == ack {
+	provider := t.passwordProvider()
+	t.accessLevel = 0
+	t.operand = ds
+	if provider == nil {
 		t.programmingMode = true
 		return nil
 	}
-	if data[0] == 'B' && data[1] == '0' {
-		return errors.New("device sent break")
-	}
-	var r DataSet
-	if err = r.UnmarshalBinary(data); err != nil {
-		return err
-	}
-	if r.Value != "" {
-		return errors.New(r.Value)
-	}
-	return ErrInvalidPassword
+	return t.authenticate(ctx, provider, level)
 }
 
 // Read Out message for protocol ModeD
 func (t *TariffDevice) ImmediateDreadOut() (*Identity, *DataBlock, error) {
-	if err := t.connection.SetBaudRate(2400); err != nil {
+	if err := t.setBaudRate(2400); err != nil {
 		return nil, nil, err
 	}
 	data, err := readMessage(t.connection)
@@ -309,71 +440,175 @@ func (t *TariffDevice) isInProgrammingMode() bool {
 	return t.programmingMode
 }
 
-func (t *TariffDevice) handShake() (*DataBlock, error) {
+func (t *TariffDevice) handShake(fn func(DataLine) error) error {
 	t.identity = nil
 	t.programmingMode = false
-	if err := t.connection.SetBaudRate(300); err != nil {
-		return nil, err
+	t.accessLevel = 0
+	if err := t.setBaudRate(300); err != nil {
+		return err
+	}
+	if err := t.wakeUp(); err != nil {
+		return err
 	}
 
 	data, _ := requestMessage(t.address).MarshalBinary()
 	data, err := t.cmd(data)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	var id Identity
 	err = id.UnmarshalBinary(data)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if id.Mode == ModeC {
 		t.identity = &id
-		return nil, nil
+		return nil
 	}
 	if id.Mode == ModeB {
-		if err = t.connection.SetBaudRate(decodeBaudRate(id.bri)); err != nil {
-			return nil, err
+		rate, err := parseBaudRate(ModeB, id.bri)
+		if err != nil {
+			return err
+		}
+		if err = t.setBaudRate(rate); err != nil {
+			return err
 		}
 	}
-	data, err = readMessage(t.connection)
-	if err != nil {
-		return nil, err
+	// identity is set for quirks lookup, it is dropped if the data message fails
+	t.identity = &id
+	if err = t.readData(fn); err != nil {
+		t.identity = nil
+		return err
 	}
 
 	if id.Mode == ModeB {
-		if err = t.connection.SetBaudRate(300); err != nil {
-			return nil, err
+		if err = t.setBaudRate(300); err != nil {
+			t.identity = nil
+			return err
 		}
 	}
 	t.lastActivity = time.Now()
 	t.programmingMode = true
-	var b DataBlock
-	err = b.UnmarshalBinary(data)
+	return nil
+}
+
+// selectBaudRate returns Mode C baud rate for option select message.
+// Reserved baud rate character is treated as the highest known rate
+// if MaxBaudRate or BaudPolicy caps it.
+func (t *TariffDevice) selectBaudRate() (int, error) {
+	offered, err := parseBaudRate(ModeC, t.identity.bri)
 	if err != nil {
-		return nil, err
+		if t.MaxBaudRate <= 0 && t.BaudPolicy == nil {
+			return 0, err
+		}
+		offered = baudRates[len(baudRates)-1]
 	}
-	t.identity = &id
-	return &b, err
+	rate := offered
+	if t.BaudPolicy != nil {
+		rate = t.BaudPolicy(*t.identity)
+	}
+	if rate > offered {
+		rate = offered
+	}
+	if t.MaxBaudRate > 0 && rate > t.MaxBaudRate {
+		rate = t.MaxBaudRate
+	}
+	for i := len(baudRates) - 1; i > 0; i-- {
+		if baudRates[i] <= rate {
+			return baudRates[i], nil
+		}
+	}
+	return baudRates[0], nil
+}
+
+// Returns the size in bytes of the last data message received from device.
+func (t *TariffDevice) LastDataSize() int {
+	return t.lastSize
+}
+
+func (t *TariffDevice) setBaudRate(rate int) error {
+	if err := t.connection.SetBaudRate(rate); err != nil {
+		return err
+	}
+	t.baudRate = rate
+	return nil
 }
 
+// reads data message calling fn for every data line and reports progress.
+func (t *TariffDevice) readData(fn func(DataLine) error) error {
+	d := NewDecoder(t.connection)
+	d.Validation = t.Validation
+	if d.Validation == DefaultValidation {
+		d.Validation = t.quirks().Validation
+	}
+	started := time.Now()
+	report := func() {
+		if t.Progress == nil {
+			return
+		}
+		p := Progress{
+			Bytes:    d.BytesRead(),
+			Lines:    d.Lines(),
+			Elapsed:  time.Since(started),
+			BaudRate: t.baudRate,
+			Expected: t.ExpectedSize,
+		}
+		if p.Expected == 0 {
+			p.Expected = t.lastSize
+		}
+		p.estimate()
+		t.Progress(p)
+	}
+	err := d.Decode(func(dl DataLine) error {
+		report()
+		if fn == nil {
+			return nil
+		}
+		return fn(dl)
+	})
+	if err != nil {
+		return err
+	}
+	report()
+	t.lastSize = d.BytesRead()
+	return t.skipTrailing()
+}
+
+// cmd sends command message and reads the reply.
+// The command is repeated if device replies with NAK, a corrupted reply is requested again with NAK.
+// A request message is repeated if identification message fails parity check.
 func (t *TariffDevice) cmd(p []byte) ([]byte, error) {
+	msg := p
+	err := ErrNAK
 	for i := 0; i < 5; i++ {
-		err := writeMessage(t.connection, p)
-		if err != nil {
+		t.requestDelay()
+		if err = writeMessage(t.connection, msg); err != nil {
 			return nil, err
 		}
-		data, err := readMessage(t.connection)
+		var data []byte
+		data, err = readMessage(t.connection)
+		if err == nil && p[0] == soh && data[0] != ack {
+			err = t.skipTrailing()
+		}
 		if err == nil {
 			t.lastActivity = time.Now()
 			return data, nil
 		}
 
-		if err == ErrNAK {
-			continue
+		var pe *ParityError
+		switch {
+		case err == ErrNAK:
+			msg = p
+		case (err == ErrBCC || errors.As(err, &pe)) && p[0] == soh:
+			msg = []byte{nak}
+		case errors.As(err, &pe):
+			// corrupted identification message, repeat the request
+			msg = p
+		default:
+			return nil, err
 		}
-		return nil, err
 	}
-	return nil, ErrNAK
+	return nil, err
 }
 
 func readMessage(c Conn) ([]byte, error) {
@@ -387,8 +622,20 @@ func readMessage(c Conn) ([]byte, error) {
 	}
 
 	data, err := func(c Conn) ([]byte, error) {
+		// the first parity error is reported after the whole frame is received
+		var parityErr error
+		parity := func(err error) error {
+			var pe *ParityError
+			if errors.As(err, &pe) {
+				if parityErr == nil {
+					parityErr = err
+				}
+				return nil
+			}
+			return err
+		}
 		head, err := c.ReadByte()
-		if err != nil {
+		if err = parity(err); err != nil {
 			return nil, err
 		}
 		var delimiter byte
@@ -397,6 +644,9 @@ func readMessage(c Conn) ([]byte, error) {
 			err = ErrNAK
 			fallthrough
 		case ack:
+			if parityErr != nil {
+				return nil, parityErr
+			}
 			return []byte{head}, err
 		case stx, soh:
 			delimiter = etx // only full blocks are supported
@@ -406,19 +656,22 @@ func readMessage(c Conn) ([]byte, error) {
 			return nil, ErrInvalidFrame
 		}
 		data, err := c.ReadBytes(delimiter)
-		if err != nil {
+		if err = parity(err); err != nil {
 			return nil, err
 		}
 
 		if delimiter == etx {
 			check, errRead := c.ReadByte()
-			if errRead != nil {
+			if errRead = parity(errRead); errRead != nil {
 				return nil, errRead
 			}
 			if check != bcc(data) {
 				err = ErrBCC
 			}
 		}
+		if parityErr != nil {
+			return data, parityErr
+		}
 		return data, err
 	}(c)
 
@@ -2,6 +2,7 @@ package iec62056
 
 import (
 	"bytes"
+	"context"
 	"net"
 	"reflect"
 	"testing"
@@ -376,6 +377,35 @@ func TestTariffDevice_ReadOut(t *testing.T) {
 	}
 }
 
+func TestTariffDevice_ReadOutFunc(t *testing.T) {
+	server, client := listen()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 6)
+		_, _ = server.Read(buf)
+		_, _ = server.Write([]byte("/iek6test\r\n"))
+		_, _ = server.Read(buf)
+		var b bytes.Buffer
+		b.WriteString("A(1)\r\nB(2)\r\n!\r\n")
+		b.WriteByte(etx)
+		_, _ = server.Write([]byte{stx})
+		_, _ = server.Write(b.Bytes())
+		_, _ = server.Write([]byte{bcc(b.Bytes())})
+	}()
+	var got []string
+	err := NewTariffDevice(client).ReadOutFunc(func(dl DataLine) error {
+		got = append(got, dl.Sets[0].Address)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"A", "B"}) {
+		t.Errorf("TariffDevice.ReadOutFunc() lines = %v", got)
+	}
+}
+
 func TestTariffDevice_Option(t *testing.T) {
 	server, client := listen()
 	defer client.Close()
@@ -550,6 +580,28 @@ func TestTariffDevice_Command(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Write acknowledged",
+			fields: fields{
+				programmingMode: true,
+				lastActivity:    time.Now(),
+				identity:        &Identity{bri: '6'},
+			},
+			fn: func(_ *testing.T) {
+				buf := make([]byte, 20)
+				_, _ = server.Read(buf)
+				_, _ = server.Write([]byte{ack})
+			},
+			cmd: Command{
+				Id: CmdW1,
+				Payload: &DataSet{
+					Address: "ADDR",
+					Value:   "1",
+				},
+			},
+			want:    &DataBlock{},
+			wantErr: false,
+		},
 		{
 			name: "Not in programming mode",
 			fields: fields{
@@ -779,13 +831,40 @@ func TestTariffDevice_enterProgrammingMode(t *testing.T) {
 			tr.pass = tt.fields.pass
 			tr.lastActivity = tt.fields.lastActivity
 			go tt.fn()
-			if err := tr.enterProgrammingMode(); (err != nil) != tt.wantErr {
+			if err := tr.enterProgrammingMode(context.Background(), 0); (err != nil) != tt.wantErr {
 				t.Errorf("TariffDevice.enterProgrammingMode() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+func TestTariffDevice_SignOn(t *testing.T) {
+	server, client := listen()
+	defer client.Close()
+	defer server.Close()
+	td := NewTariffDevice(client)
+	go func() {
+		buf := make([]byte, 15)
+		_, _ = server.Read(buf)
+		_, _ = server.Write([]byte("/iek6test\r\n"))
+		_, _ = server.Read(buf)
+		p0 := []byte{'P', '0', stx, fb, '1', rb, etx}
+		_, _ = server.Write([]byte{soh})
+		_, _ = server.Write(p0)
+		_, _ = server.Write([]byte{bcc(p0)})
+	}()
+	if err := td.SignOn(); err != nil {
+		t.Fatal(err)
+	}
+	if !td.InProgrammingMode() {
+		t.Error("programming mode is not entered")
+	}
+	// already signed on, nothing is sent
+	if err := td.SignOn(); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestTariffDevice_ImmediateReadOut(t *testing.T) {
 	server, client := listen()
 	defer client.Close()
@@ -969,3 +1048,176 @@ func Test_bcc(t *testing.T) {
 		})
 	}
 }
+
+func TestTariffDevice_Progress(t *testing.T) {
+	server, client := listen()
+	defer client.Close()
+	defer server.Close()
+	var b bytes.Buffer
+	b.WriteString("A(1)\r\nB(2)\r\n!\r\n")
+	b.WriteByte(etx)
+	go func() {
+		buf := make([]byte, 6)
+		for i := 0; i < 2; i++ {
+			_, _ = server.Read(buf)
+			_, _ = server.Write([]byte("/iek6test\r\n"))
+			_, _ = server.Read(buf)
+			_, _ = server.Write([]byte{stx})
+			_, _ = server.Write(b.Bytes())
+			_, _ = server.Write([]byte{bcc(b.Bytes())})
+		}
+	}()
+	var got []Progress
+	td := NewTariffDevice(client)
+	td.Progress = func(p Progress) {
+		got = append(got, p)
+	}
+	if _, err := td.ReadOut(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Progress calls = %v, want 3", len(got))
+	}
+	if got[0].Bytes != 6 || got[0].Lines != 1 || got[1].Lines != 2 {
+		t.Errorf("Progress() = %+v", got[:2])
+	}
+	last := got[2]
+	if last.Bytes != b.Len() || last.BaudRate != 19200 || last.Expected != 0 || last.Remaining != 0 {
+		t.Errorf("final Progress() = %+v", last)
+	}
+	if td.LastDataSize() != b.Len() {
+		t.Errorf("LastDataSize() = %v, want %v", td.LastDataSize(), b.Len())
+	}
+
+	got = nil
+	td.DropProgrammingMode()
+	if _, err := td.ReadOut(); err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Expected != b.Len() || got[0].Done() <= 0 || got[len(got)-1].Done() != 1 {
+		t.Errorf("Progress() with expected size = %+v", got)
+	}
+}
+
+func TestProgress_estimate(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Progress
+		want time.Duration
+	}{
+		{"Unknown size", Progress{Bytes: 10, Elapsed: time.Second, BaudRate: 300}, 0},
+		{"Observed rate", Progress{Bytes: 10, Expected: 30, Elapsed: time.Second, BaudRate: 300}, 2 * time.Second},
+		{"Baud rate", Progress{Expected: 30, BaudRate: 300}, time.Second},
+		{"Complete", Progress{Bytes: 40, Expected: 30, Elapsed: time.Second}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.p.estimate()
+			if tt.p.Remaining != tt.want {
+				t.Errorf("Progress.estimate() = %v, want %v", tt.p.Remaining, tt.want)
+			}
+		})
+	}
+}
+
+func TestTariffDevice_CommandRetry(t *testing.T) {
+	reply := []byte("\x02A(1)\x03")
+	reply = withParity(string(append(reply, bcc(reply[1:]))), EvenParity)
+	corrupted := append([]byte{}, reply...)
+	corrupted[3] ^= 0x80
+	badBCC := append([]byte{}, reply...)
+	badBCC[len(badBCC)-1] = withParity("\x00", EvenParity)[0]
+	tests := []struct {
+		name  string
+		reply []byte
+	}{
+		{"Parity error", corrupted},
+		{"Checksum error", badBCC},
+	}
+	cmd := Command{Id: CmdR1, Payload: &DataSet{Address: "A"}}
+	data, _ := cmd.MarshalBinary()
+	want := append(data, bcc(data[1:]), nak)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var port serialPort
+			port.rx.Write(tt.reply)
+			port.rx.Write(reply)
+			td := NewTariffDevice(NewConn(&port, ConnOptions{Parity: EvenParity}))
+			td.programmingMode = true
+			td.lastActivity = time.Now()
+			td.identity = &Identity{bri: '5'}
+			db, err := td.Command(cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if db.Lines[0].Sets[0].Value != "1" {
+				t.Errorf("Command() = %v", db)
+			}
+			tx := port.tx.Bytes()
+			for i := range tx {
+				tx[i] &= 0x7f
+			}
+			if !bytes.Equal(tx, want) {
+				t.Errorf("sent %q, want %q", tx, want)
+			}
+		})
+	}
+}
+
+func TestTariffDevice_selectBaudRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		bri     byte
+		max     int
+		policy  func(Identity) int
+		want    int
+		wantErr bool
+	}{
+		{name: "Offered", bri: '5', want: 9600},
+		{name: "19200", bri: '6', want: 19200},
+		{name: "Limited", bri: '6', max: 4800, want: 4800},
+		{name: "Limit rounded down", bri: '5', max: 5000, want: 4800},
+		{name: "Limit above offer", bri: '3', max: 9600, want: 2400},
+		{name: "Limit below 300", bri: '5', max: 100, want: 300},
+		{name: "Policy", bri: '5', policy: func(Identity) int { return 1200 }, want: 1200},
+		{name: "Policy above offer", bri: '2', policy: func(Identity) int { return 9600 }, want: 1200},
+		{name: "Policy limited", bri: '5', max: 2400, policy: func(Identity) int { return 4800 }, want: 2400},
+		{name: "Reserved character", bri: '8', wantErr: true},
+		{name: "Reserved character limited", bri: '8', max: 9600, want: 9600},
+		{name: "Reserved character policy", bri: '8', policy: func(Identity) int { return 4800 }, want: 4800},
+		{name: "Reserved character highest", bri: '8', policy: func(Identity) int { return 38400 }, want: 19200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			td := &TariffDevice{
+				MaxBaudRate: tt.max,
+				BaudPolicy:  tt.policy,
+				identity:    &Identity{Mode: ModeC, bri: tt.bri},
+			}
+			got, err := td.selectBaudRate()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("selectBaudRate() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTariffDevice_MaxBaudRate(t *testing.T) {
+	var port serialPort
+	body := []byte("A(1)\r\n!\r\n\x03")
+	port.rx.WriteString("/ABC5dev\r\n\x02")
+	port.rx.Write(body)
+	port.rx.WriteByte(bcc(body))
+	td := NewTariffDevice(NewConn(&port, ConnOptions{}))
+	td.MaxBaudRate = 4800
+	if _, err := td.ReadOut(); err != nil {
+		t.Fatal(err)
+	}
+	want := "/?!\r\n\x06040\r\n"
+	if port.tx.String() != want {
+		t.Errorf("sent %q, want %q", port.tx.String(), want)
+	}
+	if port.baudRate != 4800 {
+		t.Errorf("baud rate = %v, want 4800", port.baudRate)
+	}
+}
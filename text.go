@@ -0,0 +1,293 @@
+package iec62056
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// json representation of a data set.
+type jsonDataSet struct {
+	Address string `json:"address"`
+	Value   string `json:"value"`
+	Unit    string `json:"unit,omitempty"`
+}
+
+// json representation of identity.
+type jsonIdentity struct {
+	Manufacturer string       `json:"manufacturer"`
+	Device       string       `json:"device"`
+	Mode         ProtocolMode `json:"mode"`
+	BaudRate     int          `json:"baudRate"`
+	BaudChar     string       `json:"baudChar,omitempty"`
+	Enhanced     string       `json:"enhanced,omitempty"`
+}
+
+// MarshalText returns mode letter, e.g. "C".
+func (m ProtocolMode) MarshalText() ([]byte, error) {
+	if m < ModeA || m > ModeD {
+		return nil, errors.New("invalid protocol mode")
+	}
+	return []byte{byte(m)}, nil
+}
+
+// UnmarshalText parses mode letter.
+func (m *ProtocolMode) UnmarshalText(data []byte) error {
+	if len(data) != 1 || ProtocolMode(data[0]) < ModeA || ProtocolMode(data[0]) > ModeD {
+		return errors.New("invalid protocol mode")
+	}
+	*m = ProtocolMode(data[0])
+	return nil
+}
+
+// MarshalText returns two-character command identifier, e.g. "W1".
+func (c CommandId) MarshalText() ([]byte, error) {
+	cmd, ok := commands[c]
+	if !ok {
+		return nil, errors.New("invalid command")
+	}
+	return cmd[:], nil
+}
+
+// UnmarshalText parses command identifier.
+func (c *CommandId) UnmarshalText(data []byte) error {
+	id, err := ParseCommandId(string(data))
+	if err != nil {
+		return err
+	}
+	*c = id
+	return nil
+}
+
+// MarshalJSON encodes data set as {"address":"1.8.0","value":"12.5","unit":"kWh"}.
+func (ds DataSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonDataSet(ds))
+}
+
+// UnmarshalJSON decodes data set encoded by MarshalJSON.
+func (ds *DataSet) UnmarshalJSON(data []byte) error {
+	var v jsonDataSet
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*ds = DataSet(v)
+	return nil
+}
+
+// MarshalText returns data set in protocol form, e.g. "1.8.0(12.5*kWh)".
+func (ds DataSet) MarshalText() ([]byte, error) {
+	return ds.MarshalBinary()
+}
+
+// UnmarshalText parses data set in protocol form.
+func (ds *DataSet) UnmarshalText(data []byte) error {
+	return ds.UnmarshalBinary(data)
+}
+
+// MarshalJSON encodes data line as an array of data sets.
+func (dl DataLine) MarshalJSON() ([]byte, error) {
+	sets := dl.Sets
+	if sets == nil {
+		sets = []DataSet{}
+	}
+	return json.Marshal(sets)
+}
+
+// UnmarshalJSON decodes data line encoded by MarshalJSON.
+func (dl *DataLine) UnmarshalJSON(data []byte) error {
+	*dl = DataLine{}
+	return json.Unmarshal(data, &dl.Sets)
+}
+
+// MarshalText returns data line in protocol form, e.g. "1.8.0(12.5*kWh)1.8.1(10*kWh)".
+func (dl DataLine) MarshalText() ([]byte, error) {
+	return dl.MarshalBinary()
+}
+
+// UnmarshalText parses data line in protocol form.
+func (dl *DataLine) UnmarshalText(data []byte) error {
+	return dl.UnmarshalBinary(data)
+}
+
+// MarshalJSON encodes data block as an array of data lines.
+func (db DataBlock) MarshalJSON() ([]byte, error) {
+	lines := db.Lines
+	if lines == nil {
+		lines = []DataLine{}
+	}
+	return json.Marshal(lines)
+}
+
+// UnmarshalJSON decodes data block encoded by MarshalJSON.
+func (db *DataBlock) UnmarshalJSON(data []byte) error {
+	*db = DataBlock{}
+	return json.Unmarshal(data, &db.Lines)
+}
+
+// MarshalText returns data lines in protocol form separated by new lines.
+func (db DataBlock) MarshalText() ([]byte, error) {
+	var b bytes.Buffer
+	for _, l := range db.Lines {
+		data, err := l.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		b.Write(data)
+		b.WriteByte(lf)
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalText parses data lines in protocol form.
+func (db *DataBlock) UnmarshalText(data []byte) error {
+	return db.UnmarshalBinary(data)
+}
+
+// BaudRate returns baud rate advertised in identification message.
+// It returns ErrBaudRate for reserved baud rate characters.
+// Identity that is not received from device reports the lowest rate of its mode.
+func (id Identity) BaudRate() (int, error) {
+	if id.bri == 0 {
+		return baudRates[0], nil
+	}
+	return parseBaudRate(id.Mode, id.bri)
+}
+
+// BaudChar returns raw baud rate character of identification message,
+// or 0 if identity is not received from device.
+func (id Identity) BaudChar() byte {
+	return id.bri
+}
+
+// MarshalJSON encodes identity as {"manufacturer":"ABC","device":"dev","mode":"C","baudRate":9600}.
+// Reserved baud rate character is encoded as baudRate 0 and raw baudChar.
+func (id Identity) MarshalJSON() ([]byte, error) {
+	v := jsonIdentity{
+		Manufacturer: id.Manufacturer,
+		Device:       id.Device,
+		Mode:         id.Mode,
+		Enhanced:     id.Enhanced,
+	}
+	if rate, err := id.BaudRate(); err == nil {
+		v.BaudRate = rate
+	} else {
+		v.BaudChar = string(rune(id.bri))
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes identity encoded by MarshalJSON.
+func (id *Identity) UnmarshalJSON(data []byte) error {
+	var v jsonIdentity
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var bri byte
+	if v.BaudChar != "" {
+		if len(v.BaudChar) != 1 {
+			return errors.New("baud rate character must be 1 byte")
+		}
+		bri = v.BaudChar[0]
+	} else {
+		var err error
+		if bri, err = encodeBaudRate(v.Mode, v.BaudRate); err != nil {
+			return err
+		}
+	}
+	*id = Identity{
+		Device:       v.Device,
+		Manufacturer: v.Manufacturer,
+		Mode:         v.Mode,
+		Enhanced:     v.Enhanced,
+		bri:          bri,
+	}
+	return nil
+}
+
+// MarshalText returns identification string without frame characters, e.g. "ABC5dev".
+func (id Identity) MarshalText() ([]byte, error) {
+	if len(id.Manufacturer) != 3 {
+		return nil, errors.New("manufacturer must be 3 characters")
+	}
+	bri := id.bri
+	if bri == 0 {
+		var err error
+		if bri, err = encodeBaudRate(id.Mode, 0); err != nil {
+			return nil, err
+		}
+	}
+	rv := make([]byte, 0, len(id.Device)+2*len(id.Enhanced)+4)
+	rv = append(rv, id.Manufacturer...)
+	rv = append(rv, bri)
+	for i := 0; i < len(id.Enhanced); i++ {
+		rv = append(rv, '\\', id.Enhanced[i])
+	}
+	return append(rv, id.Device...), nil
+}
+
+// UnmarshalText parses identification string without frame characters.
+func (id *Identity) UnmarshalText(data []byte) error {
+	rv := make([]byte, 0, len(data)+2)
+	rv = append(rv, data...)
+	return id.UnmarshalBinary(append(rv, crlf...))
+}
+
+// CSVWriter writes data blocks as CSV with one row per data set.
+type CSVWriter struct {
+	// If true then the value parsed as a number is added as the last column.
+	// The column is empty for non-numeric values.
+	ParseValues bool
+	// If true then header row is not written.
+	NoHeader bool
+	// csv encoder
+	w *csv.Writer
+	// header is written flag
+	header bool
+}
+
+// NewCSVWriter creates CSV writer with "address", "value", "unit" columns.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write writes data sets of db and flushes the output.
+// The header row is written once before the first data block.
+func (c *CSVWriter) Write(db *DataBlock) error {
+	if !c.header && !c.NoHeader {
+		header := []string{"address", "value", "unit"}
+		if c.ParseValues {
+			header = append(header, "number")
+		}
+		if err := c.w.Write(header); err != nil {
+			return err
+		}
+	}
+	c.header = true
+	if db != nil {
+		for _, l := range db.Lines {
+			for _, ds := range l.Sets {
+				row := []string{ds.Address, ds.Value, ds.Unit}
+				if c.ParseValues {
+					row = append(row, parseNumber(ds.Value))
+				}
+				if err := c.w.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// parseNumber returns canonical form of numeric value or empty string.
+func parseNumber(v string) string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
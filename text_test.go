@@ -0,0 +1,194 @@
+package iec62056
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var textBlock = DataBlock{Lines: []DataLine{
+	{Sets: []DataSet{{Address: "1.8.0", Value: "001234.5", Unit: "kWh"}}},
+	{Sets: []DataSet{{Address: "0.9.1", Value: "12:00"}, {Value: "ERR"}}},
+}}
+
+func TestDataBlock_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		db   DataBlock
+		want string
+	}{
+		{
+			name: "Empty",
+			db:   DataBlock{},
+			want: `[]`,
+		},
+		{
+			name: "Lines",
+			db:   textBlock,
+			want: `[[{"address":"1.8.0","value":"001234.5","unit":"kWh"}],` +
+				`[{"address":"0.9.1","value":"12:00"},{"address":"","value":"ERR"}]]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal() = %s, want %s", got, tt.want)
+			}
+			var db DataBlock
+			if err = json.Unmarshal(got, &db); err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.db.Lines) != 0 && !reflect.DeepEqual(db, tt.db) {
+				t.Errorf("json.Unmarshal() = %v, want %v", db, tt.db)
+			}
+		})
+	}
+}
+
+func TestDataBlock_MarshalText(t *testing.T) {
+	got, err := textBlock.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1.8.0(001234.5*kWh)\n0.9.1(12:00)(ERR)\n"
+	if string(got) != want {
+		t.Errorf("DataBlock.MarshalText() = %q, want %q", got, want)
+	}
+	var db DataBlock
+	if err = db.UnmarshalText(got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(db, textBlock) {
+		t.Errorf("DataBlock.UnmarshalText() = %v, want %v", db, textBlock)
+	}
+}
+
+func TestIdentity_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      Identity
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Mode C",
+			id:   Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, bri: '5'},
+			want: `{"manufacturer":"ABC","device":"dev","mode":"C","baudRate":9600}`,
+		},
+		{
+			name: "Mode B",
+			id:   Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeB, bri: 'B'},
+			want: `{"manufacturer":"ABC","device":"dev","mode":"B","baudRate":1200}`,
+		},
+		{
+			name: "Mode A",
+			id:   Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeA, bri: 'X'},
+			want: `{"manufacturer":"ABC","device":"dev","mode":"A","baudRate":300}`,
+		},
+		{
+			name: "Reserved baud rate",
+			id:   Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, bri: '8'},
+			want: `{"manufacturer":"ABC","device":"dev","mode":"C","baudRate":0,"baudChar":"8"}`,
+		},
+		{
+			name:    "Invalid mode",
+			id:      Identity{Manufacturer: "ABC", Mode: 'Z'},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("json.Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal() = %s, want %s", got, tt.want)
+			}
+			var id Identity
+			if err = json.Unmarshal(got, &id); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(id, tt.id) {
+				t.Errorf("json.Unmarshal() = %v, want %v", id, tt.id)
+			}
+		})
+	}
+}
+
+func TestIdentity_MarshalText(t *testing.T) {
+	id := Identity{Manufacturer: "ABC", Device: "dev", Mode: ModeC, bri: '5'}
+	got, err := id.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ABC5dev" {
+		t.Errorf("Identity.MarshalText() = %s", got)
+	}
+	var id2 Identity
+	if err = id2.UnmarshalText(got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(id, id2) {
+		t.Errorf("Identity.UnmarshalText() = %v, want %v", id2, id)
+	}
+	if _, err = (Identity{Manufacturer: "AB"}).MarshalText(); err == nil {
+		t.Error("Identity.MarshalText() expected error for short manufacturer")
+	}
+}
+
+func TestCSVWriter_Write(t *testing.T) {
+	var b bytes.Buffer
+	w := NewCSVWriter(&b)
+	w.ParseValues = true
+	if err := w.Write(&textBlock); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&DataBlock{Lines: []DataLine{{Sets: []DataSet{{Address: "C.1", Value: "1,5"}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "address,value,unit,number\n" +
+		"1.8.0,001234.5,kWh,1234.5\n" +
+		"0.9.1,12:00,,\n" +
+		",ERR,,\n" +
+		"C.1,\"1,5\",,\n"
+	if b.String() != want {
+		t.Errorf("CSVWriter.Write() = %q, want %q", b.String(), want)
+	}
+}
+
+func Test_encodeBaudRate(t *testing.T) {
+	tests := []struct {
+		mode    ProtocolMode
+		rate    int
+		want    byte
+		wantErr bool
+	}{
+		{ModeA, 0, 'X', false},
+		{ModeA, 1200, 0, true},
+		{ModeB, 0, 'A', false},
+		{ModeB, 9600, 'E', false},
+		{ModeB, 300, 0, true},
+		{ModeC, 0, '0', false},
+		{ModeC, 4800, '4', false},
+		{ModeC, 1000, 0, true},
+		{ModeC, 19200, '6', false},
+		{ModeB, 19200, 'F', false},
+		{ModeD, 2400, '3', false},
+		{'Z', 300, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := encodeBaudRate(tt.mode, tt.rate)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("encodeBaudRate(%c, %v) = %c, %v, want %c", tt.mode, tt.rate, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package iec62056
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Field length limits of IEC 62056-21 data sets.
+const (
+	maxAddressLen = 16
+	maxValueLen   = 128
+	maxUnitLen    = 16
+)
+
+// Validation selects how strictly incoming data messages are checked.
+type Validation int
+
+const (
+	// DefaultValidation is Lenient unless Quirks of the device select validation.
+	DefaultValidation Validation = iota
+	// Lenient accepts vendor deviations commonly seen in the field:
+	//  - SOH instead of STX as the data message head;
+	//  - data lines terminated by LF only or not terminated before "!";
+	//  - data message closed by ETX without "!" end of data marker;
+	//  - any bytes between "!" and ETX;
+	//  - over-length addresses, values and units;
+	//  - characters outside of the ISO 646 printable set.
+	// Data sets missing boundaries are still reported as errors.
+	Lenient
+	// Strict enforces IEC 62056-21 data message syntax, field length limits and character sets.
+	// Violations are reported as *SyntaxError.
+	Strict
+)
+
+// SyntaxError describes a data message syntax violation found by strict validation.
+type SyntaxError struct {
+	// Byte offset in the message, frame head is at offset 0.
+	Offset int
+	// Data line number starting from 1.
+	Line int
+	// Violation description.
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return "line " + strconv.Itoa(e.Line) + ", offset " + strconv.Itoa(e.Offset) + ": " + e.Msg
+}
+
+// FieldError describes an invalid field of an outgoing message.
+type FieldError struct {
+	// Field name, e.g. "address".
+	Field string
+	// Offset of the offending character in the field.
+	Offset int
+	// Violation description.
+	Msg string
+}
+
+func (e *FieldError) Error() string {
+	return "invalid " + e.Field + ": " + e.Msg + " at offset " + strconv.Itoa(e.Offset)
+}
+
+// checkField validates data set field v of maximum length max, excluded characters are not allowed in the field.
+func checkField(name, v string, max int, excluded string) error {
+	for i := 0; i < len(v); i++ {
+		if i == max {
+			return &FieldError{Field: name, Offset: i, Msg: "longer than " + strconv.Itoa(max) + " characters"}
+		}
+		if !isDataChar(v[i]) || strings.IndexByte(excluded, v[i]) >= 0 {
+			return &FieldError{Field: name, Offset: i, Msg: "character " + strconv.QuoteRune(rune(v[i])) + " is not allowed"}
+		}
+	}
+	return nil
+}
+
+// checkLine validates data sets of a line without line terminator.
+// It returns the index of the offending byte and the violation description, or -1 if the line is valid.
+func checkLine(line []byte) (int, string) {
+	if len(line) == 0 {
+		return 0, "empty data line"
+	}
+	i := 0
+	for i < len(line) {
+		// address
+		from := i
+		for ; i < len(line) && line[i] != fb; i++ {
+			if !isDataChar(line[i]) || line[i] == rb {
+				return i, "invalid character in address"
+			}
+			if i-from == maxAddressLen {
+				return i, "address longer than " + strconv.Itoa(maxAddressLen) + " characters"
+			}
+		}
+		if i == len(line) {
+			return i, "front boundary is missing"
+		}
+		i++
+		// value
+		from = i
+		for ; i < len(line) && line[i] != star && line[i] != rb; i++ {
+			if !isDataChar(line[i]) || line[i] == fb {
+				return i, "invalid character in value"
+			}
+			if i-from == maxValueLen {
+				return i, "value longer than " + strconv.Itoa(maxValueLen) + " characters"
+			}
+		}
+		if i < len(line) && line[i] == star {
+			i++
+			from = i
+			for ; i < len(line) && line[i] != rb; i++ {
+				if !isDataChar(line[i]) || line[i] == fb || line[i] == star {
+					return i, "invalid character in unit"
+				}
+				if i-from == maxUnitLen {
+					return i, "unit longer than " + strconv.Itoa(maxUnitLen) + " characters"
+				}
+			}
+		}
+		if i == len(line) {
+			return i, "rear boundary is missing"
+		}
+		i++
+	}
+	return -1, ""
+}
+
+// isDataChar reports whether b is a printable ISO 646 character allowed in data sets.
+func isDataChar(b byte) bool {
+	return b >= 0x20 && b <= 0x7e && b != start && b != end
+}
@@ -0,0 +1,58 @@
+package iec62056
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_checkLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    int
+		wantMsg string
+	}{
+		{"Valid", "1.8.0(001234.5*kWh)(12)", -1, ""},
+		{"Empty", "", 0, "empty data line"},
+		{"No address", "(1)", -1, ""},
+		{"Long address", "12345678901234567(1)", 16, "address longer than 16 characters"},
+		{"Long value", "A(" + strings.Repeat("1", 129) + ")", 130, "value longer than 128 characters"},
+		{"Long unit", "A(1*12345678901234567)", 20, "unit longer than 16 characters"},
+		{"Non ASCII", "A(1\xb0)", 3, "invalid character in value"},
+		{"Control character", "A\t(1)", 1, "invalid character in address"},
+		{"Slash in unit", "A(1*m/s)", 5, "invalid character in unit"},
+		{"No front boundary", "A(1)B", 5, "front boundary is missing"},
+		{"No rear boundary", "A(1", 3, "rear boundary is missing"},
+		{"Nested boundary", "A((1)", 2, "invalid character in value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, msg := checkLine([]byte(tt.line))
+			if got != tt.want || msg != tt.wantMsg {
+				t.Errorf("checkLine() = %v, %q, want %v, %q", got, msg, tt.want, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestSyntaxError_Error(t *testing.T) {
+	err := &SyntaxError{Offset: 12, Line: 2, Msg: "empty data line"}
+	if err.Error() != "line 2, offset 12: empty data line" {
+		t.Errorf("SyntaxError.Error() = %v", err)
+	}
+}
+
+func Test_checkField(t *testing.T) {
+	err := checkField("value", "1(2", maxValueLen, "()*")
+	want := &FieldError{Field: "value", Offset: 1, Msg: "character '(' is not allowed"}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("checkField() = %v, want %v", err, want)
+	}
+	if err.Error() != "invalid value: character '(' is not allowed at offset 1" {
+		t.Errorf("FieldError.Error() = %v", err)
+	}
+	if err = checkField("unit", "kWh", maxUnitLen, "()*"); err != nil {
+		t.Errorf("checkField() = %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package iec62056
+
+import "time"
+
+// WakeUp describes a wake-up sequence of battery-powered meters sent before the request message.
+type WakeUp struct {
+	// Bytes sent repeatedly during the burst. NUL characters are sent if empty.
+	Pattern []byte
+	// Burst duration. If zero then only the pause is applied.
+	Duration time.Duration
+	// Baud rate of the burst. Zero means 300 baud.
+	BaudRate int
+	// Pause after the burst before the request message.
+	Pause time.Duration
+}
+
+// burst returns wake-up bytes that take Duration to transmit at the burst baud rate.
+// The pattern is repeated at least once.
+func (w *WakeUp) burst() []byte {
+	if w.Duration <= 0 {
+		return nil
+	}
+	pattern := w.Pattern
+	if len(pattern) == 0 {
+		pattern = []byte{0}
+	}
+	n := int(w.Duration * time.Duration(w.baudRate()) / (bitsPerChar * time.Second))
+	rv := make([]byte, 0, n+len(pattern))
+	for len(rv) == 0 || len(rv) < n {
+		rv = append(rv, pattern...)
+	}
+	return rv
+}
+
+// transmitTime returns time to transmit n characters at baud rate.
+func transmitTime(n, baudRate int) time.Duration {
+	return time.Duration(n) * bitsPerChar * time.Second / time.Duration(baudRate)
+}
+
+func (w *WakeUp) baudRate() int {
+	if w.BaudRate == 0 {
+		return 300
+	}
+	return w.BaudRate
+}
+
+// wakeUp sends wake-up sequence at the burst baud rate and restores handshake baud rate of 300.
+func (t *TariffDevice) wakeUp() error {
+	w := t.WakeUp
+	if w == nil {
+		return nil
+	}
+	if data := w.burst(); len(data) != 0 {
+		if err := t.setBaudRate(w.baudRate()); err != nil {
+			return err
+		}
+		c := t.connection
+		if c == nil {
+			return ErrNoConnection
+		}
+		if err := c.PrepareWrite(); err != nil {
+			return err
+		}
+		start := time.Now()
+		if _, err := c.Write(data); err != nil {
+			return err
+		}
+		if err := c.Flush(); err != nil {
+			return err
+		}
+		// Flush returns once the transport accepted the burst, it is still being transmitted.
+		// Changing the baud rate earlier corrupts the tail of the burst.
+		time.Sleep(time.Until(start.Add(transmitTime(len(data), w.baudRate()))))
+		if err := t.setBaudRate(300); err != nil {
+			return err
+		}
+	}
+	if w.Pause > 0 {
+		time.Sleep(w.Pause)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package iec62056
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWakeUp_burst(t *testing.T) {
+	tests := []struct {
+		name string
+		w    WakeUp
+		want []byte
+	}{
+		{"Pause only", WakeUp{Pause: time.Second}, nil},
+		{"NUL at 300 baud", WakeUp{Duration: 100 * time.Millisecond}, make([]byte, 3)},
+		{"Pattern at 2400 baud", WakeUp{Pattern: []byte{0x55, 0xaa}, Duration: 20 * time.Millisecond, BaudRate: 2400},
+			[]byte{0x55, 0xaa, 0x55, 0xaa}},
+		{"Short burst sends the pattern once", WakeUp{Pattern: []byte("ab"), Duration: time.Millisecond}, []byte("ab")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.w.burst(); !bytes.Equal(got, tt.want) {
+				t.Errorf("WakeUp.burst() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTariffDevice_WakeUp(t *testing.T) {
+	var port serialPort
+	port.rx.WriteString("/iek6test\r\n")
+	td := NewTariffDevice(NewConn(&port, ConnOptions{}))
+	td.WakeUp = &WakeUp{Duration: 100 * time.Millisecond, BaudRate: 2400, Pause: time.Millisecond}
+	start := time.Now()
+	if _, err := td.Identity(); err != nil {
+		t.Fatal(err)
+	}
+	// burst transmit time and pause
+	if elapsed := time.Since(start); elapsed < 101*time.Millisecond {
+		t.Errorf("request is sent %v after the burst start", elapsed)
+	}
+	want := append(make([]byte, 24), "/?!\r\n"...)
+	if !bytes.Equal(port.tx.Bytes(), want) {
+		t.Errorf("sent %q, want %q", port.tx.Bytes(), want)
+	}
+	if port.baudRate != 300 {
+		t.Errorf("baud rate = %v, want 300", port.baudRate)
+	}
+}